@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagAddOptions jobs.AddOptions
+
+	// addCmd adds torrents the way feed jobs do, so scripts and browser handlers keep our tags and settings
+	addCmd = &cobra.Command{
+		Use:   "add <url|magnet|file>...",
+		Short: "Add torrents with a job's location, seed ratio and tags.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := newRunner().Add(context.Background(), flagAddOptions, args)
+			if err != nil {
+				log.Fatalf("error adding torrents: %+v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(addCmd)
+	flags := addCmd.Flags()
+	flags.StringVar(&flagAddOptions.AsJob, "as-job", "", "inherit the location, seed ratio, tag and instance of this job")
+	flags.StringVar(&flagAddOptions.Instance, "instance", "", "Transmission instance to add to, if there is more than one")
+	flags.StringVar(&flagAddOptions.Location, "location", "", "download directory")
+	flags.Float64Var(&flagAddOptions.SeedRatio, "seed-ratio", 0, "seed ratio limit")
+	flags.StringSliceVar(&flagAddOptions.Tags, "tag", nil, "tag to add, can be repeated")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd keeps running jobs, and receives *arr webhooks, until it's told to stop
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run jobs on an interval and receive *arr import webhooks.",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			cancel()
+		}()
+		err := jobs.NewDaemon(newRunner()).Run(ctx)
+		if err != nil {
+			log.Fatalf("error running daemon: %+v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
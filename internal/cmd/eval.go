@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagEvalInstance string
+
+	// evalCmd tries an expression out against live torrents, instead of editing the config and doing dry runs
+	evalCmd = &cobra.Command{
+		Use:   "eval <expression>",
+		Short: "Evaluate an expression against every torrent, like a job condition.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runner := newRunner()
+			results, err := runner.Eval(context.Background(), flagEvalInstance, args[0])
+			if err != nil {
+				log.Fatalf("error evaluating expression: %+v", err)
+			}
+			printEvalResults(os.Stdout, os.Stderr, results)
+		},
+	}
+)
+
+// printEvalResults prints a table of results. Conditions only show matches, while anything else shows every value.
+func printEvalResults(out, summary io.Writer, results []jobs.EvalResult) {
+	condition := true
+	for _, result := range results {
+		if _, ok := result.Value.(bool); !ok {
+			condition = false
+			break
+		}
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	header := "INSTANCE\tNAME\tHASH\tSTATUS\tRATIO"
+	if !condition {
+		header += "\tVALUE"
+	}
+	fmt.Fprintln(w, header)
+	matches := 0
+	for _, result := range results {
+		if condition && !result.Value.(bool) {
+			continue
+		}
+		matches++
+		torrent := result.Torrent
+		row := fmt.Sprintf(
+			"%s\t%s\t%s\t%s\t%.2f",
+			torrent.Instance, torrent.Name, torrent.HashString, torrent.Status.String(), torrent.UploadRatio,
+		)
+		if !condition {
+			row += fmt.Sprintf("\t%v", result.Value)
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+	if condition {
+		fmt.Fprintf(summary, "%d of %d torrents matched\n", matches, len(results))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(evalCmd)
+	evalCmd.Flags().StringVar(&flagEvalInstance, "instance", "", "only evaluate torrents on this Transmission instance")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagExplainInstance string
+
+	// explainCmd shows why jobs did or didn't act on a torrent, instead of guessing from a dry run
+	explainCmd = &cobra.Command{
+		Use:   "explain <hash>",
+		Short: "Show why each job's condition matches a torrent or not, with the value of every sub-expression.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runner := newRunner()
+			explanations, err := runner.Explain(context.Background(), flagExplainInstance, args[0])
+			if err != nil {
+				log.Fatalf("error explaining jobs: %+v", err)
+			}
+			printExplanations(os.Stdout, explanations)
+		},
+	}
+)
+
+// printExplanations prints each torrent, then each job's verdict on it, then the value of every sub-expression of the
+// job's condition as a tree.
+func printExplanations(out io.Writer, explanations []jobs.Explanation) {
+	var torrent *jobs.TransmissionTorrent
+	for _, explanation := range explanations {
+		if explanation.Torrent != torrent {
+			torrent = explanation.Torrent
+			fmt.Fprintf(out, "%s %s (%s)\n", torrent.Instance, torrent.Name, torrent.HashString)
+		}
+		switch {
+		case explanation.Skipped != "":
+			fmt.Fprintf(out, "  %s: skipped, %s\n", explanation.Job, explanation.Skipped)
+			continue
+		case explanation.Err != nil:
+			fmt.Fprintf(out, "  %s: error\n", explanation.Job)
+		case explanation.Matched:
+			fmt.Fprintf(out, "  %s: matched\n", explanation.Job)
+		default:
+			fmt.Fprintf(out, "  %s: did not match\n", explanation.Job)
+		}
+		if len(explanation.Steps) == 0 {
+			fmt.Fprintf(out, "    %s\n", indentLines(fmt.Sprint(explanation.Err), "    "))
+		}
+		for _, step := range explanation.Steps {
+			indent := strings.Repeat("  ", step.Depth+2)
+			value := formatExplainValue(step.Value)
+			if step.Err != nil {
+				value = "error: " + indentLines(step.Err.Error(), indent+"  ")
+			}
+			line := fmt.Sprintf("%s%s → %s", indent, step.Expression, value)
+			if len(step.Operands) > 0 {
+				operands := make([]string, len(step.Operands))
+				for i, operand := range step.Operands {
+					operands[i] = formatExplainValue(operand)
+				}
+				line += " (" + strings.Join(operands, ", ") + ")"
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+}
+
+// formatExplainValue quotes strings so they stand out from the expressions next to them.
+func formatExplainValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// indentLines indents every line but the first, for multi-line errors from expr.
+func indentLines(s, indent string) string {
+	return strings.Replace(s, "\n", "\n"+indent, -1)
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.Flags().StringVar(&flagExplainInstance, "instance", "", "only look for the torrent on this Transmission instance")
+}
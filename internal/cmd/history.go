@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagHistoryTorrent  string
+	flagHistoryJob      string
+	flagHistoryInstance string
+	flagHistorySince    string
+	flagHistoryUntil    string
+)
+
+// historyCmd queries the audit log of everything jobs have done
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show what jobs have done to torrents.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runner := newRunner()
+		if runner.Config.DatabasePath == "" {
+			log.Fatalf("history requires a database")
+		}
+		query := jobs.HistoryQuery{
+			Torrent:  flagHistoryTorrent,
+			Job:      flagHistoryJob,
+			Instance: flagHistoryInstance,
+		}
+		var err error
+		if query.Since, err = parseTimeFlag(flagHistorySince); err != nil {
+			log.Fatalf("invalid --since: %+v", err)
+		}
+		if query.Until, err = parseTimeFlag(flagHistoryUntil); err != nil {
+			log.Fatalf("invalid --until: %+v", err)
+		}
+		entries, err := jobs.History(runner.Config.DatabasePath, query)
+		if err != nil {
+			log.Fatalf("error reading history: %+v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tINSTANCE\tJOB\tACTION\tHASH\tNAME\tOUTCOME")
+		for _, entry := range entries {
+			action := entry.Action
+			if entry.DryRun {
+				action += " (dry run)"
+			}
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Time.Format(time.RFC3339), entry.InstanceName(), entry.Job, action, entry.HashString, entry.Name, entry.Outcome,
+			)
+		}
+		w.Flush()
+	},
+}
+
+// parseTimeFlag accepts either an RFC 3339 timestamp or a duration relative to now, like "24h".
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	flags := historyCmd.Flags()
+	flags.StringVar(&flagHistoryTorrent, "torrent", "", "only show entries for this info hash or name substring")
+	flags.StringVar(&flagHistoryJob, "job", "", "only show entries for this job name")
+	flags.StringVar(&flagHistoryInstance, "instance", "", "only show entries for this Transmission instance")
+	flags.StringVar(&flagHistorySince, "since", "", "only show entries after this RFC 3339 time or duration ago, e.g. 24h")
+	flags.StringVar(&flagHistoryUntil, "until", "", "only show entries before this RFC 3339 time or duration ago")
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagListInstance string
+	flagListOptions  jobs.ListOptions
+	flagListOutput   string
+
+	// listCmd shows torrents with what only we know about them, like tags
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List torrents with their stored tags, feed GUIDs and import status.",
+		Long: fmt.Sprintf(
+			"List torrents with their stored tags, feed GUIDs and import status.\n\n"+
+				"Columns can be any of %s, or expressions like Torrent.ImportedFraction().",
+			strings.Join(listColumnNames(), ", "),
+		),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var write func(io.Writer, *jobs.Listing) error
+			switch flagListOutput {
+			case "table":
+				write = writeListingTable
+			case "json":
+				write = writeListingJSON
+			case "csv":
+				write = writeListingCSV
+			default:
+				log.Fatalf("invalid --output: %s", flagListOutput)
+			}
+			runner := newRunner()
+			evaluator, err := runner.NewEvaluator(context.Background(), flagListInstance)
+			if err != nil {
+				log.Fatalf("error loading torrents: %+v", err)
+			}
+			listing, err := evaluator.List(flagListOptions)
+			if err != nil {
+				log.Fatalf("error listing torrents: %+v", err)
+			}
+			if err = write(os.Stdout, listing); err != nil {
+				log.Fatalf("error writing torrents: %+v", err)
+			}
+		},
+	}
+)
+
+func listColumnNames() (names []string) {
+	for name := range jobs.ListColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func writeListingTable(out io.Writer, listing *jobs.Listing) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	header := make([]string, len(listing.Columns))
+	for i, column := range listing.Columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range listing.Rows {
+		fmt.Fprintln(w, strings.Join(formatRow(row), "\t"))
+	}
+	return w.Flush()
+}
+
+func writeListingCSV(out io.Writer, listing *jobs.Listing) error {
+	w := csv.NewWriter(out)
+	w.Write(listing.Columns)
+	for _, row := range listing.Rows {
+		w.Write(formatRow(row))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeListingJSON(out io.Writer, listing *jobs.Listing) error {
+	torrents := make([]map[string]interface{}, len(listing.Rows))
+	for i, row := range listing.Rows {
+		torrents[i] = make(map[string]interface{}, len(row))
+		for j, value := range row {
+			torrents[i][listing.Columns[j]] = value
+		}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(torrents)
+}
+
+func formatRow(row []interface{}) []string {
+	formatted := make([]string, len(row))
+	for i, value := range row {
+		formatted[i] = formatValue(value)
+	}
+	return formatted
+}
+
+// formatValue formats a column's value for text output.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(v, ",")
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	flags := listCmd.Flags()
+	flags.StringVar(&flagListInstance, "instance", "", "only list torrents on this Transmission instance")
+	flags.StringVar(&flagListOptions.Where, "where", "", "only list torrents matching this condition")
+	flags.StringSliceVar(&flagListOptions.Columns, "columns", nil, "columns to show (default "+strings.Join(jobs.DefaultListColumns, ",")+", where the config allows)")
+	flags.StringSliceVar(&flagListOptions.Sort, "sort", nil, "columns to sort by, prefixed with - to sort descending (default instance,name)")
+	flags.StringVarP(&flagListOutput, "output", "o", "table", "output format: table, json or csv")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagPlanOutput string
+	flagApplyPlan  string
+)
+
+// planCmd performs a dry run and saves what it would have done
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Perform a dry run and write the actions it would take as JSON.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runner := newRunner()
+		runner.DryRun = true
+		runner.Plan = &jobs.Plan{CreatedAt: time.Now()}
+		err := runner.Run(context.Background())
+		if err != nil {
+			log.Fatalf("error planning jobs: %+v", err)
+		}
+		output, err := json.MarshalIndent(runner.Plan, "", "  ")
+		if err != nil {
+			log.Fatalf("error marshalling plan: %+v", err)
+		}
+		output = append(output, '\n')
+		if flagPlanOutput == "" || flagPlanOutput == "-" {
+			_, err = os.Stdout.Write(output)
+		} else {
+			err = ioutil.WriteFile(flagPlanOutput, output, 0600)
+		}
+		if err != nil {
+			log.Fatalf("error writing plan: %+v", err)
+		}
+	},
+}
+
+// applyCmd performs the actions in a plan
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Perform exactly the actions in a plan, unless torrents have changed since.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := ioutil.ReadFile(flagApplyPlan)
+		if err != nil {
+			log.Fatalf("error reading plan: %+v", err)
+		}
+		var plan jobs.Plan
+		err = json.Unmarshal(input, &plan)
+		if err != nil {
+			log.Fatalf("error unmarshalling plan: %+v", err)
+		}
+		err = newRunner().Apply(context.Background(), &plan)
+		if err != nil {
+			log.Fatalf("error applying plan: %+v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringVarP(&flagPlanOutput, "output", "o", "", "file to write the plan to (default is stdout)")
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVar(&flagApplyPlan, "plan", "", "plan file written by the plan command")
+	applyCmd.MarkFlagRequired("plan")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/peterh/liner"
+	"github.com/spf13/cobra"
+)
+
+// torrentReference matches a partly typed reference to a torrent field or method at the end of a line
+var torrentReference = regexp.MustCompile(`\bTorrent\.(\w*)$`)
+
+var (
+	flagReplInstance string
+
+	// replCmd loads torrents once, then evaluates expressions as fast as they can be typed
+	replCmd = &cobra.Command{
+		Use:   "repl",
+		Short: "Evaluate expressions against torrents interactively, with tab completion.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runner := newRunner()
+			evaluator, err := runner.NewEvaluator(context.Background(), flagReplInstance)
+			if err != nil {
+				log.Fatalf("error loading torrents: %+v", err)
+			}
+			line := liner.NewLiner()
+			defer line.Close()
+			line.SetCtrlCAborts(true)
+			line.SetWordCompleter(completeTorrentReference(jobs.TorrentCompletions()))
+			fmt.Println("Type an expression, like Torrent.UploadRatio > 2, or exit to quit. Tab completes Torrent fields.")
+			for {
+				expression, err := line.Prompt("> ")
+				if err == io.EOF || err == liner.ErrPromptAborted {
+					return
+				} else if err != nil {
+					log.Fatalf("error reading expression: %+v", err)
+				}
+				expression = strings.TrimSpace(expression)
+				if expression == "" {
+					continue
+				} else if expression == "exit" || expression == "quit" {
+					return
+				}
+				line.AppendHistory(expression)
+				results, err := evaluator.Eval(expression)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					continue
+				}
+				printEvalResults(os.Stdout, os.Stdout, results)
+			}
+		},
+	}
+)
+
+// completeTorrentReference completes "Torrent." followed by the start of a field or method name.
+func completeTorrentReference(completions []string) liner.WordCompleter {
+	return func(line string, pos int) (head string, matches []string, tail string) {
+		// pos counts runes, not bytes
+		runes := []rune(line)
+		head, tail = string(runes[:pos]), string(runes[pos:])
+		reference := torrentReference.FindStringSubmatchIndex(head)
+		if reference == nil {
+			return
+		}
+		prefix := head[reference[2]:]
+		for _, completion := range completions {
+			if strings.HasPrefix(completion, prefix) {
+				matches = append(matches, completion)
+			}
+		}
+		return head[:reference[2]], matches, tail
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(replCmd)
+	replCmd.Flags().StringVar(&flagReplInstance, "instance", "", "only load torrents on this Transmission instance")
+}
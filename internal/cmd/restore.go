@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd re-adds torrents that a remove job moved into the trash
+var (
+	flagRestoreInstance string
+
+	restoreCmd = &cobra.Command{
+		Use:   "restore <hash>...",
+		Short: "Restore trashed torrents and move their data back.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := newRunner().Restore(context.Background(), flagRestoreInstance, args)
+			if err != nil {
+				log.Fatalf("error restoring torrents: %+v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVar(
+		&flagRestoreInstance, "instance", "", "Transmission instance to restore to, if trashed from more than one",
+	)
+}
@@ -44,22 +44,30 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
-		err := viper.UnmarshalExact(&cfg)
-		if err != nil {
-			log.Panicf("error unmarshaling config: %+v", err)
-		}
-		runner := &jobs.Runner{
-			Config:  cfg,
-			DryRun:  flagDryRun,
-			Verbose: flagVerbose,
-		}
-		err = runner.Run(context.Background())
+		err := newRunner().Run(context.Background())
 		if err != nil {
 			log.Fatalf("error running jobs: %+v", err)
 		}
 	},
 }
 
+// newRunner unmarshals the config and creates a runner with it.
+func newRunner() *jobs.Runner {
+	err := viper.UnmarshalExact(&cfg)
+	if err != nil {
+		log.Panicf("error unmarshaling config: %+v", err)
+	}
+	err = cfg.Resolve()
+	if err != nil {
+		log.Panicf("error resolving config: %+v", err)
+	}
+	return &jobs.Runner{
+		Config:  cfg,
+		DryRun:  flagDryRun,
+		Verbose: flagVerbose,
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -104,6 +112,6 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
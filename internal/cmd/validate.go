@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// decodeErrorPath pulls the config path out of a mapstructure error, like 'jobs[1].remove' in
+	// "'jobs[1].remove' has invalid keys: conditon"
+	decodeErrorPath = regexp.MustCompile(`^'([^']*)'`)
+	keyPathSegment  = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+)
+
+// validateCmd checks a config without connecting to anything, for pre-commit hooks and the like
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config for problems, reporting all of them.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := viper.ConfigFileUsed()
+		if configPath == "" {
+			fmt.Fprintln(os.Stderr, "no config file found")
+			os.Exit(1)
+		}
+		problems := validateConfig(configPath)
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", configPath)
+	},
+}
+
+// validateConfig returns every problem with a config file, with line and column references where possible.
+func validateConfig(configPath string) (problems []string) {
+	var root *yaml.Node
+	if ext := strings.ToLower(filepath.Ext(configPath)); ext == ".yml" || ext == ".yaml" {
+		contents, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %+v", configPath, err)}
+		}
+		var document yaml.Node
+		if err = yaml.Unmarshal(contents, &document); err != nil {
+			return []string{fmt.Sprintf("%s: %+v", configPath, err)}
+		}
+		if len(document.Content) > 0 {
+			root = document.Content[0]
+		}
+	}
+	report := func(keyPath string, err error) {
+		problems = append(problems, configProblem(configPath, root, keyPath, err))
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		report("", err)
+		return
+	}
+	var config jobs.Config
+	if err := viper.UnmarshalExact(&config); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			report("", err)
+			return
+		}
+		for _, message := range decodeErr.Errors {
+			keyPath := ""
+			if match := decodeErrorPath.FindStringSubmatch(message); match != nil {
+				keyPath = match[1]
+			}
+			report(keyPath, errors.New(message))
+		}
+		// the rest of the config can still be checked without the unknown keys
+		config = jobs.Config{}
+		if err = viper.Unmarshal(&config); err != nil {
+			return
+		}
+	}
+	// secret files usually only exist where transmission-jobs runs, so they aren't read
+	for _, err := range config.ResolveEnv() {
+		keyPath := ""
+		var resolveErr *jobs.ResolveError
+		if errors.As(err, &resolveErr) {
+			keyPath = resolveErr.Path
+		}
+		report(keyPath, err)
+	}
+	runner := jobs.Runner{Config: config}
+	for _, err := range runner.Validate() {
+		keyPath := ""
+		var jobErr *jobs.JobValidationError
+		if errors.As(err, &jobErr) {
+			keyPath = fmt.Sprintf("jobs[%d]", jobErr.Index)
+		}
+		report(keyPath, err)
+	}
+	return
+}
+
+// configProblem formats a problem like a compiler error, pointing at where keyPath is in the YAML if it can be found.
+func configProblem(configPath string, root *yaml.Node, keyPath string, err error) string {
+	if node := findYAMLNode(root, keyPath); node != nil {
+		return fmt.Sprintf("%s:%d:%d: %+v", configPath, node.Line, node.Column, err)
+	}
+	return fmt.Sprintf("%s: %+v", configPath, err)
+}
+
+// findYAMLNode finds the node a mapstructure-style path like jobs[1].remove refers to, or the deepest parent of it that
+// exists. Keys match case-insensitively, like they do in viper, and a lone value is the first item of a list, like a
+// single transmission instance.
+func findYAMLNode(root *yaml.Node, keyPath string) *yaml.Node {
+	if root == nil || keyPath == "" {
+		return nil
+	}
+	node := root
+segments:
+	for _, segment := range keyPathSegment.FindAllStringSubmatch(keyPath, -1) {
+		if segment[2] != "" {
+			index, _ := strconv.Atoi(segment[2])
+			if node.Kind != yaml.SequenceNode && index == 0 {
+				continue
+			}
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				break
+			}
+			node = node.Content[index]
+			continue
+		}
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, segment[1]) {
+				node = node.Content[i+1]
+				continue segments
+			}
+		}
+		break
+	}
+	return node
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Reset()
+	os.Unsetenv("TRANSMISSION_JOBS_TEST_UNSET")
+	configPath := path.Join(dir, "transmission-jobs.yml")
+	for name, test := range map[string]struct {
+		config   string
+		expected []string
+	}{
+		"unknown key": {
+			`transmission:
+  host: http://localhost:9091
+jobs:
+  - name: fine
+    tag:
+      name: x
+      condition: "true"
+  - name: typo
+    remove:
+      condition: "true"
+      conditon: "true"
+`,
+			[]string{configPath + ":10:7: 'Jobs[1].remove' has invalid keys: conditon"},
+		},
+		"invalid job": {
+			`transmission:
+  host: http://localhost:9091
+jobs:
+  - name: fine
+    tag:
+      name: x
+      condition: "true"
+  - name: bad trash
+    remove:
+      condition: "true"
+      delete_local: true
+      trash:
+        location: /mnt/trash
+        retention: 1h
+`,
+			[]string{configPath + ":8:5: invalid job 'bad trash': remove.trash and remove.delete_local are mutually exclusive"},
+		},
+		"unset variable": {
+			`transmission:
+  host: http://localhost:9091
+  password: ${TRANSMISSION_JOBS_TEST_UNSET}
+jobs:
+  - name: fine
+    tag:
+      name: x
+      condition: "true"
+`,
+			[]string{configPath + ":2:3: transmission 'default': environment variable(s) not set: TRANSMISSION_JOBS_TEST_UNSET"},
+		},
+		"unset variable in a job": {
+			`transmission:
+  host: http://localhost:9091
+jobs:
+  - name: fine
+    tag:
+      name: x
+      condition: "true"
+  - name: backfill
+    search:
+      url: http://localhost:9117/api
+      api_key: ${TRANSMISSION_JOBS_TEST_UNSET}
+`,
+			[]string{configPath + ":10:7: job 'backfill': search: environment variable(s) not set: TRANSMISSION_JOBS_TEST_UNSET"},
+		},
+	} {
+		if err = ioutil.WriteFile(configPath, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		viper.Reset()
+		viper.SetConfigFile(configPath)
+		if diff := cmp.Diff(test.expected, validateConfig(configPath)); diff != "" {
+			t.Errorf("%s: unexpected problems (-want +got):\n%s", name, diff)
+		}
+	}
+}
@@ -34,17 +34,23 @@ type TransmissionTorrent struct {
 
 	*StoredTorrentInfo
 
+	// Synthetic is set for torrents that only exist during a dry run, like feed items that would have been added.
+	Synthetic bool
+
+	// Instance is the name of the Transmission instance the torrent belongs to.
+	Instance string
+
 	// for internal, ephemeral use
-	sonarrDropPaths map[string]bool
+	imports *ImportIndex
 }
 
 // ToTransmissionTorrent converts the library struct to our generated struct.
-func ToTransmissionTorrent(input transmissionrpc.Torrent, sonarrDropPaths map[string]bool) TransmissionTorrent {
+func ToTransmissionTorrent(input transmissionrpc.Torrent, imports *ImportIndex) TransmissionTorrent {
 	return TransmissionTorrent{
 		{{- range .Props }}
 		{{ .FieldName }}: {{ if .Dereference }}*{{ end }}input.{{ .FieldName }},
 		{{- end }}
-		sonarrDropPaths: sonarrDropPaths,
+		imports: imports,
 	}
 }
 `))
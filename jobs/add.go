@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/hekmon/transmissionrpc"
+)
+
+// AddOptions are the settings for torrents added by Runner.Add. Settings that aren't set come from the AsJob job,
+// if there is one.
+type AddOptions struct {
+	Instance  string
+	AsJob     string
+	Location  string
+	SeedRatio float64
+	Tags      []string
+}
+
+// addJobName names adds that aren't done as a job in history.
+const addJobName = "add"
+
+// Add adds torrents from URLs, magnet links or local files the same way feed jobs add them, so that they get the same
+// location, seed ratio, tags and stored state.
+func (r *Runner) Add(ctx context.Context, options AddOptions, sources []string) (err error) {
+	job, err := r.addJob(options)
+	if err != nil {
+		return
+	}
+	if err = r.validateInstances(); err != nil {
+		return
+	}
+	defer r.close()
+	if err = r.open(); err != nil {
+		return
+	}
+	instanceName := options.Instance
+	if instanceName == "" && len(job.Instances) == 1 {
+		instanceName = job.Instances[0]
+	}
+	inst := r.instance(instanceName)
+	if instanceName == "" && len(r.instances) == 1 {
+		inst = r.instances[0]
+	}
+	if inst == nil && instanceName == "" {
+		return fmt.Errorf("there is more than one Transmission instance, pick one to add to")
+	} else if inst == nil {
+		return fmt.Errorf("unknown Transmission instance '%s'", instanceName)
+	}
+	tags := append([]string{job.addTag()}, options.Tags...)
+	for _, source := range sources {
+		payloads, err := addPayloads(source)
+		if err != nil {
+			return err
+		}
+		for _, payload := range payloads {
+			if r.DryRun {
+				log.Printf("DRY RUN: would add %s", source)
+				continue
+			}
+			log.Printf("[*] Adding %s", source)
+			if err = inst.addTorrent(ctx, job, source, source, payload, "", tags...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addJob returns the job that adds are done as, with options overriding its settings.
+func (r *Runner) addJob(options AddOptions) (job JobConfig, err error) {
+	job.Name = addJobName
+	if options.AsJob != "" {
+		found := false
+		for _, candidate := range r.Config.Jobs {
+			if candidate.Name == options.AsJob {
+				job, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return job, fmt.Errorf("unknown job '%s'", options.AsJob)
+		}
+	}
+	if options.Location != "" {
+		job.Location = options.Location
+	}
+	if options.SeedRatio != 0 {
+		job.SeedRatio = options.SeedRatio
+	}
+	return job, nil
+}
+
+// addTag returns the tag that a job gives the torrents it adds, if any.
+func (j JobConfig) addTag() string {
+	if j.FeedOptions != nil {
+		return j.FeedOptions.Tag
+	} else if j.SearchOptions != nil {
+		return j.SearchOptions.Tag
+	} else if j.WatchOptions != nil {
+		return j.WatchOptions.Tag
+	}
+	return ""
+}
+
+// addPayloads returns what to add for a URL or magnet link, which Transmission fetches itself, or for a local
+// .torrent, .magnet or text file.
+func addPayloads(source string) ([]*transmissionrpc.TorrentAddPayload, error) {
+	if parsed, err := url.Parse(source); err == nil {
+		switch strings.ToLower(parsed.Scheme) {
+		case "magnet", "http", "https":
+			return []*transmissionrpc.TorrentAddPayload{{Filename: &source}}, nil
+		}
+	}
+	return readWatchedFile(source)
+}
@@ -0,0 +1,98 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+func TestRunnerAddsAsJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	arguments, err := json.Marshal(map[string]interface{}{
+		"torrents":      []interface{}{fakeTorrent(1, "aaaa", "added")},
+		"torrent-added": map[string]interface{}{"id": 1, "name": "added", "hashString": "aaaa"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transmission, _ := fakeTransmission(t, 0, 0, string(arguments))
+	defer transmission.Close()
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Jobs: []jobs.JobConfig{
+			{
+				Name:        "linux ISOs",
+				Location:    "/mnt/downloads/isos",
+				FeedOptions: &jobs.FeedOptions{URL: "https://example.com/feed.xml", Tag: "linux"},
+			},
+			{
+				Name:          "remove tagged",
+				RemoveOptions: &jobs.RemoveOptions{Condition: `"linux" in Torrent.Tags && "manual" in Torrent.Tags`},
+			},
+		},
+	}
+	runner := jobs.Runner{Config: config}
+	err = runner.Add(
+		context.Background(),
+		jobs.AddOptions{AsJob: "linux ISOs", Tags: []string{"manual"}},
+		[]string{"magnet:?xt=urn:btih:aaaa"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only run the remove job, to see the tags the add stored
+	config.Jobs = config.Jobs[1:]
+	plan := &jobs.Plan{}
+	runner = jobs.Runner{Config: config, DryRun: true, Plan: plan}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 {
+		t.Errorf("expected the added torrent to have the job's tag and --tag, got %d actions", len(plan.Actions))
+	}
+}
+
+func TestRunnerAddKeepsStoredInfoOfDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := newFakeTransmissionState(t, fakeTorrent(1, "aaaa", "existing"))
+	defer transmission.Close()
+	transmission.add = func(arguments fakeRPCArguments) (map[string]interface{}, bool) {
+		return fakeTorrent(1, "aaaa", "existing"), true
+	}
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Jobs:         []jobs.JobConfig{{Name: "tag", TagOptions: &jobs.TagOptions{Name: "kept", Condition: "true"}}},
+	}
+	runner := jobs.Runner{Config: config}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	runner = jobs.Runner{Config: config}
+	err = runner.Add(context.Background(), jobs.AddOptions{Tags: []string{"manual"}}, []string{"magnet:?xt=urn:btih:aaaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner = jobs.Runner{Config: config}
+	results, err := runner.Eval(context.Background(), "", `"kept" in Torrent.Tags && "manual" in Torrent.Tags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Value != true {
+		t.Errorf("expected adding the torrent again to add to its tags, got %+v", results)
+	}
+}
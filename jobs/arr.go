@@ -0,0 +1,483 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	arrHistoryPageSize = 50
+	arrAPIKeyHeader    = "X-Api-Key"
+)
+
+type arrHistoryResponse struct {
+	Page         int
+	PageSize     int
+	TotalRecords int
+	Records      []arrHistoryRecord
+}
+
+type arrHistoryRecord struct {
+	ID          int64
+	Date        time.Time
+	SourceTitle string
+	EventType   string
+	DownloadID  string // not set by legacy APIs
+	Data        struct {
+		DroppedPath  string // only set by imports
+		ImportedPath string
+	}
+	arrMedia
+}
+
+// arrClient talks to any API generation of Sonarr, Radarr, Lidarr or Readarr, authenticating with a header so that
+// the API key stays out of URLs and proxy logs.
+type arrClient struct {
+	base       *url.URL
+	apiKey     string
+	httpClient *http.Client
+	arrType    string
+	apiRoot    string
+	legacy     bool // Sonarr v2 and Radarr v0.2 sort differently
+}
+
+func newArrClient(settings ArrSettings) (*arrClient, error) {
+	base, err := url.Parse(settings.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s URL '%s': %+v", settings.Type, settings.Host, err)
+	}
+	httpClient, err := settings.Transport.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error setting up %s transport: %+v", settings.Type, err)
+	}
+	client := &arrClient{base: base, apiKey: settings.APIKey, httpClient: httpClient, arrType: settings.Type}
+	switch settings.Type {
+	case ArrSonarr, ArrRadarr:
+		// Sonarr v3 and v4 and Radarr v3+ use the v3 API, while older versions don't have it at all
+		client.apiRoot = "/api/v3"
+		statusCode, err := client.get("/system/status", nil, nil)
+		if statusCode == http.StatusNotFound {
+			client.apiRoot = "/api"
+			client.legacy = true
+		} else if err != nil {
+			return nil, fmt.Errorf("error detecting %s API version: %+v", settings.Type, err)
+		}
+	case ArrLidarr, ArrReadarr:
+		client.apiRoot = "/api/v1"
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", settings.Type)
+	}
+	return client, nil
+}
+
+// get fetches an API path relative to the API root and unmarshals the response into result, if it's not nil.
+func (c *arrClient) get(apiPath string, query url.Values, result interface{}) (statusCode int, err error) {
+	return c.request(http.MethodGet, apiPath, query, nil, result)
+}
+
+// request sends body, if it's not nil, as JSON to an API path relative to the API root, and unmarshals the response
+// into result, if it's not nil.
+func (c *arrClient) request(
+	method, apiPath string, query url.Values, body, result interface{},
+) (statusCode int, err error) {
+	endpoint := *c.base
+	endpoint.Path = path.Join(endpoint.Path, c.apiRoot, apiPath)
+	endpoint.RawQuery = query.Encode()
+	var requestBody []byte
+	if body != nil {
+		requestBody, err = json.Marshal(body)
+		if err != nil {
+			return
+		}
+	}
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(requestBody))
+	if err != nil {
+		return
+	}
+	request.Header.Set(arrAPIKeyHeader, c.apiKey)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	statusCode = response.StatusCode
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		err = fmt.Errorf("error reading response body: %+v", err)
+		return
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = fmt.Errorf("%d code for %s %s", response.StatusCode, method, apiPath)
+		if response.StatusCode != http.StatusNotFound {
+			log.Printf("response: %s", responseBody)
+		}
+		return
+	}
+	if result == nil || len(responseBody) == 0 {
+		return
+	}
+	err = json.Unmarshal(responseBody, result)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling response body as JSON: %+v", err)
+	}
+	return
+}
+
+// history fetches a page of history, newest first.
+func (c *arrClient) history(page int) (history arrHistoryResponse, err error) {
+	query := url.Values{}
+	query.Set("page", strconv.FormatInt(int64(page), 10))
+	query.Set("pageSize", strconv.FormatInt(arrHistoryPageSize, 10))
+	query.Set("sortKey", "date")
+	if c.legacy {
+		query.Set("sortDir", "desc")
+	} else {
+		query.Set("sortDirection", "descending")
+	}
+	_, err = c.get("/history", query, &history)
+	return
+}
+
+// crawl walks history newest first, until maxRecords records have been seen or fn returns false. A maxRecords of 0
+// or less walks all of it.
+func (c *arrClient) crawl(maxRecords int, fn func(record arrHistoryRecord) bool) error {
+	seen := 0
+	for currentPage := 1; ; currentPage++ {
+		history, err := c.history(currentPage)
+		if err != nil {
+			return fmt.Errorf("error getting page %d of history: %+v", currentPage, err)
+		}
+		for _, record := range history.Records {
+			if maxRecords > 0 && seen >= maxRecords {
+				return nil
+			}
+			seen++
+			if !fn(record) {
+				return nil
+			}
+		}
+		if len(history.Records) == 0 || currentPage*arrHistoryPageSize >= history.TotalRecords {
+			return nil
+		}
+	}
+}
+
+// ArrImports are the downloads an *arr server has imported.
+type ArrImports struct {
+	Hashes map[string]bool            // lowercase info hashes, from download IDs
+	Paths  map[string]bool            // drop paths, as Transmission sees them
+	Files  map[string]map[string]bool // lowercase info hash -> the drop paths imported from it
+}
+
+func newArrImports() *ArrImports {
+	return &ArrImports{
+		Hashes: make(map[string]bool),
+		Paths:  make(map[string]bool),
+		Files:  make(map[string]map[string]bool),
+	}
+}
+
+// add records an import as Transmission would see it.
+func (a *ArrImports) add(settings ArrSettings, downloadID, droppedPath string) {
+	if droppedPath != "" {
+		a.Paths[settings.mapPath(droppedPath)] = true
+	}
+	if downloadID == "" {
+		return
+	}
+	hash := strings.ToLower(downloadID)
+	a.Hashes[hash] = true
+	if droppedPath != "" {
+		if a.Files[hash] == nil {
+			a.Files[hash] = make(map[string]bool)
+		}
+		a.Files[hash][settings.mapPath(droppedPath)] = true
+	}
+}
+
+// FetchArrImports crawls a Sonarr, Radarr, Lidarr or Readarr server's history for imported downloads, going back up
+// to maxRecords items.
+func FetchArrImports(settings ArrSettings, maxRecords int) (*ArrImports, error) {
+	client, err := newArrClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	imports := newArrImports()
+	err = client.crawl(maxRecords, func(record arrHistoryRecord) bool {
+		if record.Data.DroppedPath != "" {
+			imports.add(settings, record.DownloadID, record.Data.DroppedPath)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error crawling %s history: %+v", settings.Type, err)
+	}
+	return imports, nil
+}
+
+// ArrImport is an import from an *arr server's history, stored so that it doesn't have to be fetched again.
+type ArrImport struct {
+	Key         string `boltholdKey:"Key"`
+	Source      string `boltholdIndex:"Source"`
+	DownloadID  string
+	DroppedPath string // as the *arr server sees it, so that changes to path mappings apply
+	Date        time.Time
+}
+
+// ArrSyncState records how far an *arr server's history has been synced.
+type ArrSyncState struct {
+	Source       string `boltholdKey:"Source"`
+	LastRecordID int64
+	SyncedAt     time.Time
+}
+
+// source identifies an *arr server in stored state.
+func (s ArrSettings) source() string {
+	return s.Type + "@" + s.Host
+}
+
+// historyLimit returns the maximum number of history records to fetch per run without a database, or on the first
+// sync with one, or 0 for no limit.
+func (s ArrSettings) historyLimit() int {
+	if s.HistoryLimit == 0 {
+		return defaultArrHistoryLimit
+	} else if s.HistoryLimit < 0 {
+		return 0
+	}
+	return s.HistoryLimit
+}
+
+// syncArrImports fetches history newer than what's already in the database, stores the imports in it, and returns
+// every import stored for the server. A read-only runner returns the new imports along with the stored ones instead.
+func (r *Runner) syncArrImports(settings ArrSettings) (*ArrImports, error) {
+	client, err := newArrClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	source := settings.source()
+	var state ArrSyncState
+	err = r.db.Get(source, &state)
+	if err != nil && err != bolthold.ErrNotFound {
+		return nil, fmt.Errorf("error loading %s sync state: %+v", settings.Type, err)
+	}
+	var (
+		lastSeenID = state.LastRecordID
+		fresh      []ArrImport
+		limit      = settings.historyLimit()
+	)
+	// the limit only applies to the first sync. After that, stopping short of the last record seen would skip
+	// everything in between for good.
+	if state.LastRecordID > 0 {
+		limit = 0
+	}
+	err = client.crawl(limit, func(record arrHistoryRecord) bool {
+		// record IDs only go up, so anything older has been synced already
+		if record.ID <= state.LastRecordID {
+			return false
+		}
+		if record.ID > lastSeenID {
+			lastSeenID = record.ID
+		}
+		if record.Data.DroppedPath != "" {
+			fresh = append(fresh, ArrImport{
+				Key:         fmt.Sprintf("%s/%d", source, record.ID),
+				Source:      source,
+				DownloadID:  record.DownloadID,
+				DroppedPath: record.Data.DroppedPath,
+				Date:        record.Date,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error crawling %s history: %+v", settings.Type, err)
+	}
+	if r.readOnly {
+		// use the new imports without storing them, so that the next run still syncs them
+		imports, err := r.storedArrImports(settings, source)
+		if err != nil {
+			return nil, err
+		}
+		for _, fetched := range fresh {
+			imports.add(settings, fetched.DownloadID, fetched.DroppedPath)
+		}
+		return imports, nil
+	}
+	if r.Verbose {
+		log.Printf("[*] Synced %d new import(s) from %s", len(fresh), settings.Host)
+	}
+	err = r.db.Bolt().Update(func(tx *bolt.Tx) error {
+		for i := range fresh {
+			if err := r.db.TxUpsert(tx, fresh[i].Key, &fresh[i]); err != nil {
+				return err
+			}
+		}
+		state = ArrSyncState{Source: source, LastRecordID: lastSeenID, SyncedAt: time.Now()}
+		return r.db.TxUpsert(tx, source, &state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving %s imports: %+v", settings.Type, err)
+	}
+	return r.storedArrImports(settings, source)
+}
+
+// storedArrImports returns every import stored for a source, as Transmission would see it.
+func (r *Runner) storedArrImports(settings ArrSettings, source string) (*ArrImports, error) {
+	imports := newArrImports()
+	err := r.db.ForEach(bolthold.Where("Source").Eq(source).Index("Source"), func(stored *ArrImport) error {
+		imports.add(settings, stored.DownloadID, stored.DroppedPath)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s imports: %+v", settings.Type, err)
+	}
+	return imports, nil
+}
+
+// loadImports builds the index of everything the configured *arr servers have imported, and everything received by
+// webhook.
+func (r *Runner) loadImports() error {
+	sources := r.Config.arrSources()
+	if len(sources) == 0 && r.Config.Daemon.Webhook == nil {
+		return nil
+	}
+	if err := r.Config.Imports.Validate(); err != nil {
+		return err
+	}
+	r.imports = NewImportIndex(r.Config.Imports)
+	for _, source := range sources {
+		var (
+			imports *ArrImports
+			err     error
+		)
+		if r.db != nil {
+			imports, err = r.syncArrImports(source)
+		} else {
+			imports, err = FetchArrImports(source, source.historyLimit())
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching %s history from %s: %+v", source.Type, source.Host, err)
+		}
+		r.imports.Add(source.Type, imports)
+	}
+	if r.db == nil {
+		return nil
+	}
+	for _, arrType := range arrTypes {
+		settings := r.Config.arrSettings(arrType)
+		imports, err := r.storedArrImports(settings, webhookSource(arrType))
+		if err != nil {
+			return err
+		}
+		if len(imports.Hashes) > 0 || len(imports.Paths) > 0 || r.Config.Daemon.Webhook != nil {
+			r.imports.Add(arrType, imports)
+		}
+	}
+	return nil
+}
+
+// ImportIndex records which types of *arr servers imported which downloads.
+type ImportIndex struct {
+	options ImportOptions
+	types   map[string]bool                       // configured types
+	hashes  map[string]map[string]bool            // info hash -> types that imported it
+	paths   map[string]map[string]bool            // drop path -> types that imported it
+	files   map[string]map[string]map[string]bool // info hash -> drop path imported from it -> types that imported it
+}
+
+// NewImportIndex creates an empty ImportIndex, with options for which files count.
+func NewImportIndex(options ImportOptions) *ImportIndex {
+	return &ImportIndex{
+		options: options,
+		types:   make(map[string]bool),
+		hashes:  make(map[string]map[string]bool),
+		paths:   make(map[string]map[string]bool),
+		files:   make(map[string]map[string]map[string]bool),
+	}
+}
+
+// Add records the downloads imported by a type of *arr server.
+func (i *ImportIndex) Add(arrType string, imports *ArrImports) {
+	i.types[arrType] = true
+	addImported(i.hashes, arrType, imports.Hashes)
+	addImported(i.paths, arrType, imports.Paths)
+	for hash, paths := range imports.Files {
+		if i.files[hash] == nil {
+			i.files[hash] = make(map[string]map[string]bool)
+		}
+		addImported(i.files[hash], arrType, paths)
+	}
+}
+
+func addImported(index map[string]map[string]bool, arrType string, keys map[string]bool) {
+	for key := range keys {
+		if index[key] == nil {
+			index[key] = make(map[string]bool)
+		}
+		index[key][arrType] = true
+	}
+}
+
+// imported returns whether a type of *arr server imported something, or any of them if arrType is empty.
+func imported(types map[string]bool, arrType string) bool {
+	if arrType == "" {
+		return len(types) > 0
+	}
+	return types[arrType]
+}
+
+// importedFile returns whether a type of *arr server imported a torrent's file, going by the drop paths it imported
+// from the torrent. Those are matched on the file's path inside the torrent, since they're only as Transmission would
+// see them when path mappings are configured. Without any drop paths, the whole torrent was imported.
+func (i *ImportIndex) importedFile(hash, name, arrType string) bool {
+	hash = strings.ToLower(hash)
+	if !imported(i.hashes[hash], arrType) {
+		return false
+	}
+	known := false
+	for droppedPath, types := range i.files[hash] {
+		if !imported(types, arrType) {
+			continue
+		}
+		if droppedPath == name || strings.HasSuffix(droppedPath, "/"+name) {
+			return true
+		}
+		known = true
+	}
+	return !known
+}
+
+// counts returns whether a file counts towards whether a torrent was imported.
+func (i *ImportIndex) counts(name string, wanted bool) bool {
+	if i.options.IgnoreUnwanted && !wanted {
+		return false
+	}
+	name = strings.ToLower(name)
+	base := path.Base(name)
+	for _, glob := range i.options.Ignore {
+		glob = strings.ToLower(glob)
+		// globs were validated up front
+		if matched, _ := path.Match(glob, base); matched {
+			return false
+		}
+		if matched, _ := path.Match(glob, name); matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hekmon/transmissionrpc"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+const arrImportRecords = `[
+	{"id": 2, "eventType": "downloadFolderImported", "downloadId": "AAAA", "data": {"droppedPath": "/downloads/a.mkv"}},
+	{"id": 1, "eventType": "grabbed", "data": {}}
+]`
+
+// fakeArr serves one page of history records at historyPath, and a system status at statusPath if it's set.
+func fakeArr(t *testing.T, statusPath, historyPath string, records *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("apikey") != "" {
+			t.Error("API key was sent in the URL")
+		}
+		if r.Header.Get("X-Api-Key") != "deadbeef" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case statusPath:
+			w.Write([]byte(`{"version": "4.0.0.0"}`))
+		case historyPath:
+			var decoded []interface{}
+			json.Unmarshal([]byte(*records), &decoded)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"page":         1,
+				"pageSize":     50,
+				"totalRecords": len(decoded),
+				"records":      json.RawMessage(*records),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetchArrImports(t *testing.T) {
+	for name, test := range map[string]struct {
+		arrType, statusPath, historyPath string
+	}{
+		"legacy sonarr": {jobs.ArrSonarr, "", "/sonarr/api/history"},
+		"sonarr v4":     {jobs.ArrSonarr, "/sonarr/api/v3/system/status", "/sonarr/api/v3/history"},
+		"lidarr":        {jobs.ArrLidarr, "", "/sonarr/api/v1/history"},
+	} {
+		records := arrImportRecords
+		server := fakeArr(t, test.statusPath, test.historyPath, &records)
+		imports, err := jobs.FetchArrImports(jobs.ArrSettings{
+			Type:         test.arrType,
+			Host:         server.URL + "/sonarr",
+			APIKey:       "deadbeef",
+			PathMappings: []jobs.PathMapping{{Arr: "/downloads/", Transmission: "/data/torrents"}},
+		}, 100)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %+v", name, err)
+			continue
+		}
+		if diff := cmp.Diff(imports, &jobs.ArrImports{
+			Hashes: map[string]bool{"aaaa": true},
+			Paths:  map[string]bool{"/data/torrents/a.mkv": true},
+			Files:  map[string]map[string]bool{"aaaa": {"/data/torrents/a.mkv": true}},
+		}); diff != "" {
+			t.Errorf("%s: %s", name, diff)
+		}
+	}
+}
+
+// importTestTorrent returns a torrent with a video and an NFO file.
+func importTestTorrent(t *testing.T, imports *jobs.ImportIndex) jobs.TransmissionTorrent {
+	raw := fakeTorrent(1, "aaaa", "movie")
+	raw["downloadDir"] = "/downloads"
+	raw["files"] = []map[string]interface{}{{"name": "a.mkv", "length": 900}, {"name": "a.nfo", "length": 100}}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input transmissionrpc.Torrent
+	if err = json.Unmarshal(encoded, &input); err != nil {
+		t.Fatal(err)
+	}
+	return jobs.ToTransmissionTorrent(input, imports)
+}
+
+func TestImportedBy(t *testing.T) {
+	imports := jobs.NewImportIndex(jobs.ImportOptions{})
+	imports.Add(jobs.ArrSonarr, &jobs.ArrImports{Paths: map[string]bool{"/downloads/a.mkv": true}})
+	torrent := importTestTorrent(t, imports)
+	if torrent.Imported() {
+		t.Error("expected the torrent's extra file to keep it from matching by path")
+	}
+	imports.Add(jobs.ArrRadarr, &jobs.ArrImports{Hashes: map[string]bool{"aaaa": true}})
+	if !torrent.Imported() || !torrent.ImportedBy(jobs.ArrRadarr) {
+		t.Error("expected the torrent to be imported by radarr")
+	}
+	if torrent.ImportedBy(jobs.ArrSonarr) {
+		t.Error("expected the torrent not to be imported by sonarr")
+	}
+}
+
+func TestRunnerRemembersArrImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "episode"))
+	defer transmission.Close()
+	var records string
+	sonarr := fakeArr(t, "/api/v3/system/status", "/api/v3/history", &records)
+	defer sonarr.Close()
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Sonarr:       &jobs.SonarrSettings{Host: sonarr.URL, APIKey: "deadbeef"},
+		Jobs: []jobs.JobConfig{{
+			Name:          "remove imported",
+			RemoveOptions: &jobs.RemoveOptions{Condition: "Torrent.Imported()"},
+		}},
+	}
+	// the import falls out of the history Sonarr returns, but should be remembered from the first run
+	for run, history := range []string{arrImportRecords, "[]"} {
+		records = history
+		plan := &jobs.Plan{}
+		runner := jobs.Runner{Config: config, DryRun: true, Plan: plan}
+		if err = runner.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Actions) != 1 {
+			t.Errorf("run %d: expected the torrent to be imported, got %d actions", run+1, len(plan.Actions))
+		}
+	}
+}
+
+func TestImportedFraction(t *testing.T) {
+	for name, test := range map[string]struct {
+		options          jobs.ImportOptions
+		expectedImported bool
+		expectedFraction float64
+	}{
+		"all files":   {jobs.ImportOptions{}, false, 0.5},
+		"ignore NFOs": {jobs.ImportOptions{Ignore: []string{"*.NFO"}}, true, 1},
+	} {
+		imports := jobs.NewImportIndex(test.options)
+		imports.Add(jobs.ArrRadarr, &jobs.ArrImports{Paths: map[string]bool{"/downloads/a.mkv": true}})
+		torrent := importTestTorrent(t, imports)
+		if imported := torrent.Imported(); imported != test.expectedImported {
+			t.Errorf("%s: expected Imported() to be %t", name, test.expectedImported)
+		}
+		if fraction := torrent.ImportedFraction(); fraction != test.expectedFraction {
+			t.Errorf("%s: expected ImportedFraction() to be %f, got %f", name, test.expectedFraction, fraction)
+		}
+		if importedBytes := torrent.ImportedBytes(); importedBytes != 900 {
+			t.Errorf("%s: expected ImportedBytes() to be 900, got %d", name, importedBytes)
+		}
+	}
+}
+
+func TestImportedFractionByHash(t *testing.T) {
+	for name, test := range map[string]struct {
+		files            map[string]bool
+		expectedImported bool
+		expectedFraction float64
+		expectedBytes    int64
+	}{
+		"hash only":          {nil, true, 1, 1000},
+		"unmapped drop path": {map[string]bool{"/data/a.mkv": true, "/data/a.nfo": true}, true, 1, 1000},
+		"one file of a pack": {map[string]bool{"/data/a.mkv": true}, false, 0.5, 900},
+	} {
+		imports := jobs.NewImportIndex(jobs.ImportOptions{})
+		arrImports := &jobs.ArrImports{Hashes: map[string]bool{"aaaa": true}}
+		if test.files != nil {
+			arrImports.Files = map[string]map[string]bool{"aaaa": test.files}
+		}
+		imports.Add(jobs.ArrSonarr, arrImports)
+		torrent := importTestTorrent(t, imports)
+		if imported := torrent.Imported(); imported != test.expectedImported {
+			t.Errorf("%s: expected Imported() to be %t", name, test.expectedImported)
+		}
+		if fraction := torrent.ImportedFraction(); fraction != test.expectedFraction {
+			t.Errorf("%s: expected ImportedFraction() to be %f, got %f", name, test.expectedFraction, fraction)
+		}
+		if importedBytes := torrent.ImportedBytes(); importedBytes != test.expectedBytes {
+			t.Errorf("%s: expected ImportedBytes() to be %d, got %d", name, test.expectedBytes, importedBytes)
+		}
+	}
+}
+
+func TestRunnerSyncsPastHistoryLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "bbbb", "episode"))
+	defer transmission.Close()
+	records := arrImportRecords
+	sonarr := fakeArr(t, "/api/v3/system/status", "/api/v3/history", &records)
+	defer sonarr.Close()
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Sonarr:       &jobs.SonarrSettings{Host: sonarr.URL, APIKey: "deadbeef", HistoryLimit: 2},
+		Jobs: []jobs.JobConfig{{
+			Name:          "remove imported",
+			RemoveOptions: &jobs.RemoveOptions{Condition: "Torrent.Imported()"},
+		}},
+	}
+	// more records arrive between runs than the limit, and the import is the oldest of them
+	for run, history := range []string{arrImportRecords, `[
+		{"id": 5, "eventType": "grabbed", "data": {}},
+		{"id": 4, "eventType": "grabbed", "data": {}},
+		{"id": 3, "eventType": "downloadFolderImported", "downloadId": "BBBB", "data": {"droppedPath": "/downloads/b.mkv"}},
+		{"id": 2, "eventType": "downloadFolderImported", "downloadId": "AAAA", "data": {"droppedPath": "/downloads/a.mkv"}},
+		{"id": 1, "eventType": "grabbed", "data": {}}
+	]`} {
+		records = history
+		plan := &jobs.Plan{}
+		runner := jobs.Runner{Config: config, DryRun: true, Plan: plan}
+		if err = runner.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if imported := len(plan.Actions) == 1; imported != (run == 1) {
+			t.Errorf("run %d: expected the torrent to be imported only after the second run, got %d actions", run+1, len(plan.Actions))
+		}
+	}
+}
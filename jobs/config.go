@@ -1,49 +1,252 @@
 package jobs
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mmcdole/gofeed"
 )
 
 // Config describes the schema of the .yml config file
 type Config struct {
-	DatabasePath string `mapstructure:"database"`
-	Transmission TransmissionSettings
-	Sonarr       *SonarrSettings
+	DatabasePath string                 `mapstructure:"database"`
+	Transmission []TransmissionSettings // a single instance may be given without a list
+	Sonarr       *SonarrSettings        // shorthand for an Arr entry with type sonarr
+	Arr          []ArrSettings
+	Imports      ImportOptions
+	Daemon       DaemonSettings
 	Jobs         []JobConfig
 }
 
-// SonarrSettings describes how to connect to a Sonarr server.
-type SonarrSettings struct {
-	Host   string
-	APIKey string `mapstructure:"api_key"`
+// ArrSettings describes how to connect to a Sonarr, Radarr, Lidarr or Readarr server.
+type ArrSettings struct {
+	Type         string // one of the Arr* constants
+	Host         string
+	APIKey       string `mapstructure:"api_key"`
+	APIKeyFile   string `mapstructure:"api_key_file"` // optional, read into APIKey by Config.Resolve
+	Transport    TransportSettings
+	PathMappings []PathMapping `mapstructure:"path_mappings"` // optional, the first matching mapping applies
+	HistoryLimit int           `mapstructure:"history_limit"` // optional, records to fetch per run until synced. Negative is unlimited.
+}
+
+const defaultArrHistoryLimit = 1000
+
+// PathMapping translates a directory as an *arr server sees it to how Transmission sees it, for when they mount the
+// same storage in different places.
+type PathMapping struct {
+	Arr          string
+	Transmission string
+}
+
+// mapPath translates a path as an *arr server sees it to how Transmission sees it.
+func (s ArrSettings) mapPath(arrPath string) string {
+	for _, mapping := range s.PathMappings {
+		from := path.Clean(mapping.Arr)
+		if arrPath == from || strings.HasPrefix(arrPath, strings.TrimSuffix(from, "/")+"/") {
+			return path.Join(mapping.Transmission, strings.TrimPrefix(arrPath, from))
+		}
+	}
+	return arrPath
+}
+
+// ImportOptions describes which files count towards whether a torrent was imported.
+type ImportOptions struct {
+	Ignore         []string // optional, case-insensitive globs matched against file names, like "*.nfo"
+	IgnoreUnwanted bool     `mapstructure:"ignore_unwanted"` // skip files that aren't being downloaded
+}
+
+// Validate returns whether this is a legit thing we can do or not.
+func (i ImportOptions) Validate() error {
+	for _, glob := range i.Ignore {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid imports.ignore glob '%s': %+v", glob, err)
+		}
+	}
+	return nil
+}
+
+// SonarrSettings describes how to connect to a Sonarr server. Its Type is ignored.
+type SonarrSettings = ArrSettings
+
+// Supported ArrSettings.Type values
+const (
+	ArrSonarr  = "sonarr"
+	ArrRadarr  = "radarr"
+	ArrLidarr  = "lidarr"
+	ArrReadarr = "readarr"
+)
+
+var arrTypes = []string{ArrSonarr, ArrRadarr, ArrLidarr, ArrReadarr}
+
+// arrSettings returns the settings of the first configured *arr server of a type, or just the type if there isn't one.
+func (c Config) arrSettings(arrType string) ArrSettings {
+	for _, source := range c.arrSources() {
+		if source.Type == arrType {
+			return source
+		}
+	}
+	return ArrSettings{Type: arrType}
+}
+
+// DaemonSettings describes what the daemon command does.
+type DaemonSettings struct {
+	Interval time.Duration    // optional, how often to run every job
+	Webhook  *WebhookSettings // optional
+}
+
+// WebhookSettings describes how to receive "On Import" webhooks from *arr servers.
+type WebhookSettings struct {
+	Listen       string
+	Username     string   // optional, for basic authentication
+	Password     string   // optional
+	PasswordFile string   `mapstructure:"password_file"` // optional, read into Password by Config.Resolve
+	Jobs         []string // optional, jobs to run after each import
+}
+
+// arrSources returns every configured *arr server.
+func (c Config) arrSources() []ArrSettings {
+	sources := c.Arr
+	if c.Sonarr != nil {
+		sonarr := *c.Sonarr
+		sonarr.Type = ArrSonarr
+		sources = append([]ArrSettings{sonarr}, sources...)
+	}
+	return sources
 }
 
 // TransmissionSettings describes how to connect to a Transmission RPC server.
 type TransmissionSettings struct {
-	Host     string
-	Username string
-	Password string
+	Name         string // optional with only one instance, which is then called defaultInstanceName
+	Host         string
+	Username     string
+	Password     string
+	PasswordFile string `mapstructure:"password_file"` // optional, read into Password by Config.Resolve
+	RPCPath      string `mapstructure:"rpc_path"`      // optional, for reverse proxies
+	Transport    TransportSettings
+	Timeout      time.Duration // optional, per RPC call
+	Retries      int           // optional, for calls that are safe to retry. Negative disables retries.
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"` // optional, doubled after each retry
+	PollInterval time.Duration `mapstructure:"poll_interval"` // optional, for waiting on moves and verifications
+}
+
+// TransportSettings describes how to make HTTP(S) connections to a server.
+type TransportSettings struct {
+	CAFile             string `mapstructure:"ca_file"`   // optional, trusted in addition to the system's CAs
+	CertFile           string `mapstructure:"cert_file"` // optional, for client certificate authentication
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	Proxy              string // optional, defaults to $HTTPS_PROXY/$HTTP_PROXY
 }
 
 // JobConfig describes jobs to run. The presence of each 'SomethingOptions' field denotes the action.
 type JobConfig struct {
-	Name          string
-	Location      string
-	SeedRatio     float64        `mapstructure:"seed_ratio"`
-	RemoveOptions *RemoveOptions `mapstructure:"remove"`
-	TagOptions    *TagOptions    `mapstructure:"tag"`
-	FeedOptions   *FeedOptions   `mapstructure:"feed"`
+	Name           string
+	Location       string
+	SeedRatio      float64         `mapstructure:"seed_ratio"`
+	RemoveOptions  *RemoveOptions  `mapstructure:"remove"`
+	TagOptions     *TagOptions     `mapstructure:"tag"`
+	FeedOptions    *FeedOptions    `mapstructure:"feed"`
+	MigrateOptions *MigrateOptions `mapstructure:"migrate"`
+	SearchOptions  *SearchOptions  `mapstructure:"search"`
+	WatchOptions   *WatchOptions   `mapstructure:"watch"`
+	OnError        string          `mapstructure:"on_error"` // optional, one of the OnError* constants
+	Retries        int             // optional, for OnErrorRetry
+	RetryDelay     time.Duration   `mapstructure:"retry_delay"` // optional, for OnErrorRetry. Grows with each retry.
+	Instances      []string        // optional, names of the Transmission instances to run on. Defaults to all of them.
+}
+
+// What to do when a job fails.
+const (
+	// OnErrorAbort stops running any further jobs. This is the default.
+	OnErrorAbort = "abort"
+	// OnErrorContinue moves on to the next job.
+	OnErrorContinue = "continue"
+	// OnErrorRetry runs the job again up to Retries times, then moves on to the next job.
+	OnErrorRetry = "retry"
+)
+
+const (
+	defaultJobRetries    = 3
+	defaultJobRetryDelay = 5 * time.Second
+)
+
+// validateOnError checks the job's error policy and fills in defaults.
+func (j *JobConfig) validateOnError() error {
+	switch j.OnError {
+	case "":
+		j.OnError = OnErrorAbort
+	case OnErrorAbort, OnErrorContinue:
+	case OnErrorRetry:
+		if j.Retries < 0 {
+			return fmt.Errorf("retries must not be negative")
+		}
+		if j.Retries == 0 {
+			j.Retries = defaultJobRetries
+		}
+		if j.RetryDelay < 0 {
+			return fmt.Errorf("retry_delay must not be negative")
+		}
+		if j.RetryDelay == 0 {
+			j.RetryDelay = defaultJobRetryDelay
+		}
+	default:
+		return fmt.Errorf("invalid on_error: %s", j.OnError)
+	}
+	return nil
+}
+
+// condition returns the expression or feed match that decides what the job acts on.
+func (j JobConfig) condition() string {
+	if j.RemoveOptions != nil {
+		return j.RemoveOptions.Condition
+	} else if j.TagOptions != nil {
+		return j.TagOptions.Condition
+	} else if j.MigrateOptions != nil {
+		return j.MigrateOptions.Condition
+	} else if j.FeedOptions != nil && j.FeedOptions.Match != nil {
+		return fmt.Sprintf("%s =~ %s", j.FeedOptions.Match.Field, j.FeedOptions.Match.RegExp)
+	} else if j.SearchOptions != nil && j.SearchOptions.Match != nil {
+		return fmt.Sprintf("%s =~ %s", j.SearchOptions.Match.Field, j.SearchOptions.Match.RegExp)
+	}
+	return ""
 }
 
 // RemoveOptions describes when and how to remove a torrent.
 type RemoveOptions struct {
 	DeleteLocal bool `mapstructure:"delete_local"`
 	Condition   string
+	Trash       *TrashOptions // optional
+	Notify      []string      // optional, Notify* constants for *arr servers to act on once a torrent is removed
+}
+
+// TrashOptions describes where to quarantine torrent data instead of deleting it right away.
+type TrashOptions struct {
+	Location  string
+	Retention time.Duration // optional, defaults to defaultTrashRetention
+}
+
+const defaultTrashRetention = 7 * 24 * time.Hour
+
+// Validate returns whether this is a legit thing we can do or not.
+func (t *TrashOptions) Validate() error {
+	if t.Location == "" {
+		return fmt.Errorf("must specify remove.trash.location")
+	}
+	if t.Retention < 0 {
+		return fmt.Errorf("remove.trash.retention must not be negative")
+	}
+	if t.Retention == 0 {
+		t.Retention = defaultTrashRetention
+	}
+	return nil
 }
 
 // TagOptions describes when and how to tag a torrent.
@@ -53,6 +256,37 @@ type TagOptions struct {
 	Ephemeral bool
 }
 
+// MigrateOptions describes when to move a torrent to another Transmission instance that shares its storage.
+type MigrateOptions struct {
+	To        string // name of the instance to move to
+	Condition string
+	Notify    []string // optional, Notify* constants for *arr servers to act on once a torrent is migrated
+}
+
+const (
+	// NotifyRemoveFromQueue removes the torrent from *arr queues, without touching it in Transmission.
+	NotifyRemoveFromQueue = "remove_from_queue"
+	// NotifyBlocklist removes the torrent from *arr queues and blocklists the release so it isn't grabbed again.
+	NotifyBlocklist = "blocklist"
+	// NotifyRescan rescans whatever the torrent was downloaded for, so that *arr servers notice moved files.
+	NotifyRescan = "rescan"
+)
+
+// validateNotify checks the *arr notifications a job asks for.
+func (c Config) validateNotify(notify []string) error {
+	if len(notify) > 0 && len(c.arrSources()) == 0 {
+		return errors.New("notify requires an *arr server")
+	}
+	for _, notification := range notify {
+		switch notification {
+		case NotifyRemoveFromQueue, NotifyBlocklist, NotifyRescan:
+		default:
+			return fmt.Errorf("invalid notify: %s", notification)
+		}
+	}
+	return nil
+}
+
 // FeedOptions describes how to add a torrent from an Atom/RSS feed.
 type FeedOptions struct {
 	URL   string
@@ -70,8 +304,147 @@ type FeedMatchOptions struct {
 
 var (
 	validFeedFields = make(map[string]string)
+	envReference    = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
 )
 
+// ResolveError is a section of the config that couldn't be resolved.
+type ResolveError struct {
+	Section string // how errors describe the section, like transmission 'seedbox'
+	Path    string // where the section is in the config, like transmission[1]
+	Err     error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%s: %+v", e.Section, e.Err)
+}
+
+// Resolve expands ${ENV} references in connection settings and reads secrets from files. Call it after unmarshalling.
+func (c *Config) Resolve() error {
+	if errs := c.resolve(true); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ResolveEnv expands ${ENV} references like Resolve, but doesn't read secrets from files, which may only exist where
+// transmission-jobs runs. It returns a *ResolveError for every section that couldn't be resolved.
+func (c *Config) ResolveEnv() []error {
+	return c.resolve(false)
+}
+
+func (c *Config) resolve(readSecrets bool) (errs []error) {
+	report := func(section, path string, err error) {
+		if err != nil {
+			errs = append(errs, &ResolveError{Section: section, Path: path, Err: err})
+		}
+	}
+	report("database", "database", expandEnv(&c.DatabasePath))
+	for i := range c.Transmission {
+		name := c.Transmission[i].Name
+		if name == "" {
+			name = defaultInstanceName
+		}
+		report(
+			fmt.Sprintf("transmission '%s'", name), fmt.Sprintf("transmission[%d]", i),
+			c.Transmission[i].resolve(readSecrets),
+		)
+	}
+	if c.Sonarr != nil {
+		report("sonarr", "sonarr", c.Sonarr.resolve(readSecrets))
+	}
+	for i := range c.Arr {
+		report(fmt.Sprintf("arr '%s'", c.Arr[i].Host), fmt.Sprintf("arr[%d]", i), c.Arr[i].resolve(readSecrets))
+	}
+	for i := range c.Jobs {
+		if search := c.Jobs[i].SearchOptions; search != nil {
+			err := expandEnv(&search.URL, &search.APIKey, &search.APIKeyFile)
+			if err == nil {
+				err = search.Transport.resolve()
+			}
+			if err == nil {
+				err = readSecretFile("api_key", &search.APIKey, search.APIKeyFile, readSecrets)
+			}
+			report(fmt.Sprintf("job '%s': search", c.Jobs[i].Name), fmt.Sprintf("jobs[%d].search", i), err)
+		}
+	}
+	if webhook := c.Daemon.Webhook; webhook != nil {
+		err := expandEnv(&webhook.Listen, &webhook.Username, &webhook.Password, &webhook.PasswordFile)
+		if err == nil {
+			err = readSecretFile("password", &webhook.Password, webhook.PasswordFile, readSecrets)
+		}
+		report("daemon.webhook", "daemon.webhook", err)
+	}
+	return
+}
+
+func (t *TransmissionSettings) resolve(readSecrets bool) error {
+	err := expandEnv(&t.Host, &t.Username, &t.Password, &t.PasswordFile, &t.RPCPath)
+	if err != nil {
+		return err
+	}
+	err = t.Transport.resolve()
+	if err != nil {
+		return err
+	}
+	return readSecretFile("password", &t.Password, t.PasswordFile, readSecrets)
+}
+
+func (s *ArrSettings) resolve(readSecrets bool) error {
+	err := expandEnv(&s.Host, &s.APIKey, &s.APIKeyFile)
+	if err != nil {
+		return err
+	}
+	err = s.Transport.resolve()
+	if err != nil {
+		return err
+	}
+	return readSecretFile("api_key", &s.APIKey, s.APIKeyFile, readSecrets)
+}
+
+func (t *TransportSettings) resolve() error {
+	return expandEnv(&t.CAFile, &t.CertFile, &t.KeyFile, &t.Proxy)
+}
+
+// expandEnv replaces ${NAME} with the NAME environment variable. Unlike os.ExpandEnv, bare $NAME is left alone so
+// that passwords can contain dollar signs, and unset variables are an error rather than empty.
+func expandEnv(fields ...*string) error {
+	for _, field := range fields {
+		var missing []string
+		*field = envReference.ReplaceAllStringFunc(*field, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			value, exists := os.LookupEnv(name)
+			if !exists {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("environment variable(s) not set: %s", strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads a secret from path into value, if path is set. Unless read is set, it only checks that value
+// isn't set too.
+func readSecretFile(name string, value *string, path string, read bool) error {
+	if path == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %s_file are mutually exclusive", name, name)
+	}
+	if !read {
+		return nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s_file: %+v", name, err)
+	}
+	*value = strings.TrimRight(string(contents), "\r\n")
+	return nil
+}
+
 // Validate returns whether this is a legit thing we can do or not (and caches some stuff)
 func (f *FeedOptions) Validate() error {
 	if f.Match != nil {
@@ -91,6 +464,57 @@ func (f *FeedOptions) Validate() error {
 	return nil
 }
 
+// WatchOptions describes a directory of .torrent files and files of magnet links to add.
+type WatchOptions struct {
+	Directory string
+	Tag       string // optional
+}
+
+// Validate returns whether this is a legit thing we can do or not.
+func (w *WatchOptions) Validate() error {
+	if w.Directory == "" {
+		return errors.New("must specify watch.directory")
+	}
+	return nil
+}
+
+// SearchOptions describes a search of a Torznab endpoint, like the ones Jackett and Prowlarr serve. Results are added
+// like feed items.
+type SearchOptions struct {
+	URL        string        // the Torznab endpoint, like http://localhost:9117/api/v2.0/indexers/all/results/torznab
+	APIKey     string        `mapstructure:"api_key"`
+	APIKeyFile string        `mapstructure:"api_key_file"` // optional, read into APIKey by Config.Resolve
+	Queries    []string      // optional, defaults to the latest releases
+	Categories []int         // optional, Newznab category IDs
+	Limit      int           // optional, results per query
+	Interval   time.Duration // optional, how long to wait between searches. Requires a database.
+	Tag        string        // optional
+	Match      *FeedMatchOptions
+	Transport  TransportSettings
+}
+
+// Validate returns whether this is a legit thing we can do or not (and caches the match regexp)
+func (s *SearchOptions) Validate() error {
+	if s.URL == "" {
+		return errors.New("must specify search.url")
+	}
+	if _, err := url.Parse(s.URL); err != nil {
+		return fmt.Errorf("invalid search.url: %+v", err)
+	}
+	if s.Limit < 0 {
+		return errors.New("search.limit must not be negative")
+	}
+	if s.Interval < 0 {
+		return errors.New("search.interval must not be negative")
+	}
+	// matching works just like it does for feeds
+	feed := FeedOptions{Match: s.Match}
+	if err := feed.Validate(); err != nil {
+		return errors.New(strings.Replace(err.Error(), "feed.", "search.", 1))
+	}
+	return nil
+}
+
 func feedItemMatches(item gofeed.Item, options *FeedMatchOptions) bool {
 	if options == nil {
 		return true
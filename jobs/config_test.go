@@ -0,0 +1,70 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+func TestConfigResolve(t *testing.T) {
+	secret, err := ioutil.TempFile("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret.Name())
+	secret.WriteString("hunter2\n")
+	secret.Close()
+	os.Setenv("TRANSMISSION_JOBS_TEST_SECRET", secret.Name())
+	os.Setenv("TRANSMISSION_JOBS_TEST_KEY", "deadbeef")
+	defer os.Unsetenv("TRANSMISSION_JOBS_TEST_SECRET")
+	defer os.Unsetenv("TRANSMISSION_JOBS_TEST_KEY")
+
+	config := jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{
+			Username:     "$literal",
+			PasswordFile: "${TRANSMISSION_JOBS_TEST_SECRET}",
+		}},
+		Sonarr: &jobs.SonarrSettings{APIKey: "${TRANSMISSION_JOBS_TEST_KEY}"},
+	}
+	if err = config.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Transmission[0].Username != "$literal" {
+		t.Errorf("expected bare $ to be left alone, got %s", config.Transmission[0].Username)
+	}
+	if config.Transmission[0].Password != "hunter2" {
+		t.Errorf("expected password to be read from file, got %s", config.Transmission[0].Password)
+	}
+	if config.Sonarr.APIKey != "deadbeef" {
+		t.Errorf("expected api_key to be expanded, got %s", config.Sonarr.APIKey)
+	}
+
+	config = jobs.Config{Transmission: []jobs.TransmissionSettings{{Password: "${TRANSMISSION_JOBS_TEST_UNSET}"}}}
+	if err = config.Resolve(); err == nil {
+		t.Error("expected an unset variable to be an error")
+	}
+}
+
+func TestConfigResolveEnvKeepsGoing(t *testing.T) {
+	config := jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: "http://localhost:9091", PasswordFile: "/nonexistent/secret"}},
+		Arr:          []jobs.ArrSettings{{Type: jobs.ArrRadarr, APIKey: "${TRANSMISSION_JOBS_TEST_UNSET}"}},
+		Jobs: []jobs.JobConfig{
+			{Name: "bad condition", RemoveOptions: &jobs.RemoveOptions{Condition: "Torrent.Name =="}},
+		},
+	}
+	// the missing secret file isn't read, but the unset variable is still a problem
+	errs := config.ResolveEnv()
+	if len(errs) != 1 {
+		t.Fatalf("expected one problem, got %+v", errs)
+	}
+	if resolveErr, ok := errs[0].(*jobs.ResolveError); !ok || resolveErr.Path != "arr[0]" {
+		t.Errorf("expected a problem with arr[0], got %+v", errs[0])
+	}
+	runner := jobs.Runner{Config: config}
+	if errs = runner.Validate(); len(errs) != 1 {
+		t.Errorf("expected the invalid job to be reported too, got %+v", errs)
+	}
+}
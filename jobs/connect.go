@@ -1,110 +1,103 @@
 package jobs
 
 import (
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
-
-	"github.com/hekmon/transmissionrpc"
 )
 
-// ConnectToRemote creates an *transmissionrpc.Client.
-func ConnectToRemote(settings TransmissionSettings) (*transmissionrpc.Client, error) {
-	uri, err := url.Parse(settings.Host)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing Host: %+v", err)
-	}
-	port, err := strconv.ParseUint(uri.Port(), 10, 16)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing port as uint16: %+v", err)
+// HTTPClient creates an *http.Client with these settings.
+func (t TransportSettings) HTTPClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_file: %+v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in ca_file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
 	}
-	advancedConfig := &transmissionrpc.AdvancedConfig{
-		Port:  uint16(port),
-		HTTPS: (strings.ToLower(uri.Scheme) == "https"),
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("cert_file and key_file must be specified together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %+v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	return transmissionrpc.New(
-		uri.Hostname(),
-		settings.Username,
-		settings.Password,
-		advancedConfig,
-	)
-}
-
-const sonarrHistoryPageSize = 50
-
-type sonarrHistoryResponse struct {
-	Page         int
-	PageSize     int
-	TotalRecords int
-	Records      []struct {
-		SourceTitle string
-		EventType   string
-		Data        struct {
-			DroppedPath  string
-			ImportedPath string
+	transport.TLSClientConfig = tlsConfig
+	if t.Proxy != "" {
+		proxyURL, err := url.Parse(t.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing proxy: %+v", err)
 		}
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
+	return &http.Client{Transport: transport}, nil
 }
 
-// FetchSonarrDrops crawls Sonarr's history for filesystem drop paths, going back up to maxRecords items.
-// If maxRecords <= 0, this exhausts all possbile history items.
-func FetchSonarrDrops(settings SonarrSettings, maxRecords int) (paths map[string]bool, err error) {
-	endpoint, err := url.Parse(settings.Host)
+// ConnectToRemote creates a *TransmissionClient.
+func ConnectToRemote(settings TransmissionSettings) (*TransmissionClient, error) {
+	uri, err := url.Parse(settings.Host)
 	if err != nil {
-		err = fmt.Errorf("error parsing Sonarr URL '%s': %+v", settings.Host, err)
-		return
+		return nil, fmt.Errorf("error parsing Host: %+v", err)
 	}
-	paths = make(map[string]bool)
-	endpoint.Path = "/api/history"
-	query := endpoint.Query()
-	query.Set("apikey", settings.APIKey)
-	query.Set("sortkey", "date")
-	query.Set("sortDir", "desc")
-	query.Set("pageSize", strconv.FormatInt(sonarrHistoryPageSize, 10))
-	for currentPage := 1; ; currentPage++ {
-		query.Set("page", strconv.FormatInt(int64(currentPage), 10))
-		endpoint.RawQuery = query.Encode()
-		var (
-			response     *http.Response
-			responseBody []byte
-			history      sonarrHistoryResponse
-		)
-		response, err = http.DefaultClient.Get(endpoint.String())
+	// reverse proxies usually sit on the scheme's default port
+	if uri.Port() != "" {
+		_, err = strconv.ParseUint(uri.Port(), 10, 16)
 		if err != nil {
-			err = fmt.Errorf("error getting page %d of sonarr history: %+v", currentPage, err)
-			return
-		}
-		responseBody, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			err = fmt.Errorf("error reading response body: %+v", err)
-			return
-		}
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("%d code getting page %d of sonarr history", response.StatusCode, currentPage)
-			log.Printf("response: %s", responseBody)
-			return
-		}
-		err = json.Unmarshal(responseBody, &history)
-		if err != nil {
-			err = fmt.Errorf("error unmarshalling response body as JSON: %+v", err)
-			return
-		}
-		for _, record := range history.Records {
-			if record.Data.DroppedPath == "" {
-				continue
-			}
-			paths[record.Data.DroppedPath] = true
-		}
-		// terminate loop?
-		nextMaxRecord := (currentPage + 1) * sonarrHistoryPageSize
-		if nextMaxRecord > history.TotalRecords || (maxRecords > 0 && nextMaxRecord > maxRecords) {
-			break
+			return nil, fmt.Errorf("error parsing port as uint16: %+v", err)
 		}
 	}
-	return
+	// reverse proxies tend to mount Transmission somewhere else
+	switch {
+	case settings.RPCPath != "":
+		uri.Path = settings.RPCPath
+	case uri.Path == "" || uri.Path == "/":
+		uri.Path = defaultRPCPath
+	}
+	httpClient, err := settings.Transport.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error setting up transport: %+v", err)
+	}
+	client := &TransmissionClient{
+		url:        uri.String(),
+		username:   settings.Username,
+		password:   settings.Password,
+		httpClient: httpClient,
+		timeout:    settings.Timeout,
+		retries:    settings.Retries,
+		backoff:    settings.RetryBackoff,
+
+		pollInterval: settings.PollInterval,
+	}
+	if client.timeout <= 0 {
+		client.timeout = defaultRPCTimeout
+	}
+	if client.retries < 0 {
+		client.retries = 0
+	} else if client.retries == 0 {
+		client.retries = defaultRPCRetries
+	}
+	if client.backoff <= 0 {
+		client.backoff = defaultRPCBackoff
+	}
+	if client.pollInterval <= 0 {
+		client.pollInterval = defaultPollInterval
+	}
+	return client, nil
 }
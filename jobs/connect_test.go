@@ -0,0 +1,152 @@
+package jobs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to PEM files.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "transmission-jobs"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = path.Join(dir, "client.pem"), path.Join(dir, "client.key")
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// transportGet makes a GET request with a client built from transport settings.
+func transportGet(settings jobs.TransportSettings, url string) error {
+	client, err := settings.HTTPClient()
+	if err != nil {
+		return err
+	}
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func TestTransportSettingsHTTPClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writeServerCA(t, dir, server)
+	for name, test := range map[string]struct {
+		settings jobs.TransportSettings
+		succeeds bool
+	}{
+		"defaults":             {jobs.TransportSettings{}, false},
+		"ca_file":              {jobs.TransportSettings{CAFile: caFile}, false},
+		"client certificate":   {jobs.TransportSettings{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, true},
+		"insecure_skip_verify": {jobs.TransportSettings{InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile}, true},
+	} {
+		if err = transportGet(test.settings, server.URL); (err == nil) != test.succeeds {
+			t.Errorf("%s: expected success to be %t, got %+v", name, test.succeeds, err)
+		}
+	}
+	if _, err = (jobs.TransportSettings{CertFile: certFile}).HTTPClient(); err == nil {
+		t.Error("expected cert_file without key_file to fail")
+	}
+}
+
+func TestTransportSettingsProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+	if err := transportGet(jobs.TransportSettings{Proxy: proxy.URL}, "http://transmission.invalid/rpc"); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://transmission.invalid/rpc" {
+		t.Errorf("expected the request to go through the proxy, got %v", proxied)
+	}
+}
+
+func TestConnectToRemoteRPCPath(t *testing.T) {
+	server, _ := fakeTransmission(t, 0, 0, `{"torrents": []}`)
+	defer server.Close()
+	var paths []string
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	})
+	for _, test := range []struct {
+		settings jobs.TransmissionSettings
+		expected string
+	}{
+		{jobs.TransmissionSettings{Host: server.URL}, "/transmission/rpc"},
+		{jobs.TransmissionSettings{Host: server.URL + "/custom/rpc"}, "/custom/rpc"},
+		{jobs.TransmissionSettings{Host: server.URL + "/custom/rpc", RPCPath: "/torrents/transmission/rpc"}, "/torrents/transmission/rpc"},
+	} {
+		paths = nil
+		client, err := jobs.ConnectToRemote(test.settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.TorrentGetAll(context.Background()); err != nil {
+			t.Errorf("%s: %+v", test.settings.Host, err)
+		}
+		if len(paths) == 0 {
+			t.Errorf("%s: expected requests to %s", test.settings.Host, test.expected)
+		}
+		for _, requested := range paths {
+			if requested != test.expected {
+				t.Errorf("%s: expected requests to %s, got %s", test.settings.Host, test.expected, requested)
+			}
+		}
+	}
+}
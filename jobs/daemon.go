@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	webhookPathPrefix   = "/webhook/"
+	webhookEventImport  = "Download" // what *arr servers call "On Import"
+	webhookEventTest    = "Test"
+	webhookMaxBodyBytes = 1 << 20
+)
+
+// Daemon runs jobs on an interval and receives "On Import" webhooks from *arr servers, so that jobs can act on imports
+// right away instead of waiting for the next poll of their history.
+type Daemon struct {
+	Runner *Runner
+
+	// runs and writing imports both need the database, which only one of them can have open at a time
+	lock     sync.Mutex
+	triggers chan struct{}
+	// imports from webhooks wait here until the database is free, so that webhooks don't wait for runs to finish
+	pendingLock sync.Mutex
+	pending     []ArrImport
+	flushes     chan struct{}
+}
+
+// NewDaemon creates a Daemon that runs jobs with runner's settings.
+func NewDaemon(runner *Runner) *Daemon {
+	return &Daemon{Runner: runner, triggers: make(chan struct{}, 1), flushes: make(chan struct{}, 1)}
+}
+
+// webhookSource identifies imports received by webhook from a type of *arr server in stored state.
+func webhookSource(arrType string) string {
+	return "webhook/" + arrType
+}
+
+// Run runs every job each interval, and the webhook's jobs after each import, until ctx is done.
+func (d *Daemon) Run(ctx context.Context) error {
+	settings := d.Runner.Config.Daemon
+	if settings.Interval <= 0 && settings.Webhook == nil {
+		return errors.New("daemon needs an interval, a webhook or both")
+	}
+	if settings.Interval < 0 {
+		return errors.New("daemon.interval must not be negative")
+	}
+	if webhook := settings.Webhook; webhook != nil {
+		if d.Runner.Config.DatabasePath == "" {
+			return errors.New("daemon.webhook requires a database")
+		}
+		if webhook.Listen == "" {
+			return errors.New("must specify daemon.webhook.listen")
+		}
+		if err := d.validateWebhookJobs(); err != nil {
+			return err
+		}
+		server := &http.Server{Addr: webhook.Listen, Handler: d}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
+		log.Printf("[*] Listening for webhooks on %s", webhook.Listen)
+		defer func() {
+			if err := <-serveErr; err != http.ErrServerClosed {
+				log.Printf("error serving webhooks: %+v", err)
+			}
+		}()
+		defer server.Close()
+	}
+	var tick <-chan time.Time
+	if settings.Interval > 0 {
+		ticker := time.NewTicker(settings.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		d.run(ctx, nil)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			d.flush()
+			return nil
+		case <-tick:
+			d.run(ctx, nil)
+		case <-d.triggers:
+			d.run(ctx, settings.Webhook.Jobs)
+		case <-d.flushes:
+			d.flush()
+		}
+	}
+}
+
+func (d *Daemon) validateWebhookJobs() error {
+	for _, name := range d.Runner.Config.Daemon.Webhook.Jobs {
+		found := false
+		for _, job := range d.Runner.Config.Jobs {
+			if job.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown daemon.webhook job '%s'", name)
+		}
+	}
+	return nil
+}
+
+// run runs some jobs, or all of them if names is nil, on a fresh copy of the runner. Failures are logged, since the
+// next run might go better.
+func (d *Daemon) run(ctx context.Context, names []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.writePending(); err != nil {
+		log.Printf("error recording imports: %+v", err)
+	}
+	runner := *d.Runner
+	if names != nil {
+		runner.Config.Jobs = nil
+		for _, job := range d.Runner.Config.Jobs {
+			for _, name := range names {
+				if job.Name == name {
+					runner.Config.Jobs = append(runner.Config.Jobs, job)
+				}
+			}
+		}
+	}
+	if err := runner.Run(ctx); err != nil {
+		log.Printf("error running jobs: %+v", err)
+	}
+}
+
+// arrWebhook is the part of a Sonarr, Radarr, Lidarr or Readarr webhook payload that describes an import.
+type arrWebhook struct {
+	EventType    string
+	DownloadID   string
+	EpisodeFile  *arrWebhookFile // Sonarr
+	EpisodeFiles []arrWebhookFile
+	MovieFile    *arrWebhookFile  // Radarr
+	TrackFiles   []arrWebhookFile // Lidarr
+	BookFiles    []arrWebhookFile // Readarr
+}
+
+type arrWebhookFile struct {
+	SourcePath string // where the file was dropped, i.e. in the download
+}
+
+// droppedPaths returns the drop paths of every imported file in the webhook.
+func (w arrWebhook) droppedPaths() (paths []string) {
+	files := append(append(append([]arrWebhookFile{}, w.EpisodeFiles...), w.TrackFiles...), w.BookFiles...)
+	for _, file := range []*arrWebhookFile{w.EpisodeFile, w.MovieFile} {
+		if file != nil {
+			files = append(files, *file)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.SourcePath != "" && !seen[file.SourcePath] {
+			seen[file.SourcePath] = true
+			paths = append(paths, file.SourcePath)
+		}
+	}
+	return
+}
+
+// ServeHTTP receives webhooks at /webhook/<type>, like /webhook/sonarr.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	settings := d.Runner.Config.Daemon.Webhook
+	arrType := strings.TrimPrefix(request.URL.Path, webhookPathPrefix)
+	known := false
+	for _, validType := range arrTypes {
+		known = known || arrType == validType
+	}
+	if settings == nil || !strings.HasPrefix(request.URL.Path, webhookPathPrefix) || !known {
+		http.NotFound(w, request)
+		return
+	}
+	if request.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if settings.Username != "" || settings.Password != "" {
+		username, password, _ := request.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(username), []byte(settings.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(settings.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="transmission-jobs"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	var payload arrWebhook
+	err := json.NewDecoder(http.MaxBytesReader(w, request.Body, webhookMaxBodyBytes)).Decode(&payload)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid webhook: %+v", err), http.StatusBadRequest)
+		return
+	}
+	if payload.EventType != webhookEventImport {
+		if payload.EventType != webhookEventTest && d.Runner.Verbose {
+			log.Printf("[*] Ignoring %s webhook: %s", arrType, payload.EventType)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	d.queueImport(arrType, payload)
+	// runs write pending imports first, and a run or write that's already pending will see this import too
+	trigger := d.flushes
+	if len(settings.Jobs) > 0 {
+		trigger = d.triggers
+	}
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queueImport queues the imports in a webhook to be written, keyed so that redelivered webhooks don't add duplicates.
+func (d *Daemon) queueImport(arrType string, payload arrWebhook) {
+	var (
+		source = webhookSource(arrType)
+		now    = time.Now()
+	)
+	droppedPaths := payload.droppedPaths()
+	if len(droppedPaths) == 0 {
+		droppedPaths = []string{""}
+	}
+	log.Printf("[+] Recording %s import of %s", arrType, payload.DownloadID)
+	d.pendingLock.Lock()
+	defer d.pendingLock.Unlock()
+	for _, droppedPath := range droppedPaths {
+		d.pending = append(d.pending, ArrImport{
+			Key:         fmt.Sprintf("%s/%s/%s", source, strings.ToLower(payload.DownloadID), droppedPath),
+			Source:      source,
+			DownloadID:  payload.DownloadID,
+			DroppedPath: droppedPath,
+			Date:        now,
+		})
+	}
+}
+
+// flush writes pending imports once the database is free.
+func (d *Daemon) flush() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.writePending(); err != nil {
+		log.Printf("error recording imports: %+v", err)
+	}
+}
+
+// writePending writes pending imports to the database, keeping them pending if that fails. The caller must hold lock.
+func (d *Daemon) writePending() error {
+	d.pendingLock.Lock()
+	imports := d.pending
+	d.pending = nil
+	d.pendingLock.Unlock()
+	if len(imports) == 0 {
+		return nil
+	}
+	err := d.write(imports)
+	if err != nil {
+		d.pendingLock.Lock()
+		d.pending = append(imports, d.pending...)
+		d.pendingLock.Unlock()
+	}
+	return err
+}
+
+func (d *Daemon) write(imports []ArrImport) error {
+	db, err := bolthold.Open(d.Runner.Config.DatabasePath, 0600, nil)
+	if err != nil {
+		return fmt.Errorf("error opening database @ %s: %+v", d.Runner.Config.DatabasePath, err)
+	}
+	defer db.Close()
+	return db.Bolt().Update(func(tx *bolt.Tx) error {
+		for i := range imports {
+			if err := db.TxUpsert(tx, imports[i].Key, &imports[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package jobs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+func TestDaemonReceivesWebhooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// once armed, Transmission holds up the daemon's first run until released
+	var (
+		block, unblock           sync.Once
+		armed, blocked, released = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	)
+	release := func() {
+		unblock.Do(func() { close(released) })
+	}
+	fake := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "movie"))
+	defer fake.Close()
+	transmission := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-armed:
+			block.Do(func() {
+				close(blocked)
+				<-released
+			})
+		default:
+		}
+		fake.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer transmission.Close()
+	runner := jobs.Runner{
+		Config: jobs.Config{
+			DatabasePath: path.Join(dir, "db.bbolt"),
+			Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+			Daemon: jobs.DaemonSettings{
+				Interval: time.Hour,
+				Webhook:  &jobs.WebhookSettings{Listen: "localhost:0", Username: "radarr", Password: "hunter2"},
+			},
+			Jobs: []jobs.JobConfig{{
+				Name:          "remove imported",
+				RemoveOptions: &jobs.RemoveOptions{Condition: `Torrent.ImportedBy("radarr")`},
+			}},
+		},
+		DryRun: true,
+	}
+	daemon := jobs.NewDaemon(&runner)
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+	defer release()
+	post := func(username, body string) int {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/webhook/radarr", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.SetBasicAuth(username, "hunter2")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	imported := func() bool {
+		run := runner
+		run.Plan = &jobs.Plan{}
+		if err := run.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return len(run.Plan.Actions) == 1
+	}
+	if imported() {
+		t.Error("expected nothing to be imported before an import webhook")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	close(armed)
+	go func() {
+		done <- daemon.Run(ctx)
+	}()
+	<-blocked
+	const importWebhook = `{"eventType": "Download", "downloadId": "AAAA", "movieFile": {"sourcePath": "/downloads/movie.mkv"}}`
+	if status := post("sonarr", importWebhook); status != http.StatusUnauthorized {
+		t.Errorf("expected a webhook with the wrong credentials to be unauthorized, got %d", status)
+	}
+	if status := post("radarr", `{"eventType": "Test"}`); status != http.StatusNoContent {
+		t.Errorf("expected a test webhook to be accepted, got %d", status)
+	}
+	// the import is accepted while the run still has the database
+	accepted := make(chan int)
+	go func() {
+		accepted <- post("radarr", importWebhook)
+	}()
+	select {
+	case status := <-accepted:
+		if status != http.StatusNoContent {
+			t.Errorf("expected the import webhook to be accepted, got %d", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the import webhook waited for the run to finish")
+	}
+	release()
+	// and written once the run is done
+	deadline := time.Now().Add(5 * time.Second)
+	for !imported() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the torrent to be imported after an import webhook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+)
+
+// EvalResult is what an expression evaluated to for one torrent.
+type EvalResult struct {
+	Torrent *TransmissionTorrent
+	Value   interface{}
+}
+
+// Evaluator evaluates expressions against torrents that were loaded once, the way job conditions are.
+type Evaluator struct {
+	torrents       []*TransmissionTorrent // sorted by instance, then name
+	defaultColumns []string               // DefaultListColumns, less those the config can't fill in
+}
+
+// Eval evaluates an expression against every torrent without running any jobs, so that conditions can be tried out.
+// Results are sorted by instance, then name.
+func (r *Runner) Eval(ctx context.Context, instanceName, expression string) ([]EvalResult, error) {
+	// fail before any network stuff
+	if _, err := compileEval(expression); err != nil {
+		return nil, err
+	}
+	evaluator, err := r.NewEvaluator(ctx, instanceName)
+	if err != nil {
+		return nil, err
+	}
+	return evaluator.Eval(expression)
+}
+
+// NewEvaluator loads every torrent, or only those on one instance, along with their stored state and imports. The
+// database is only read from, so it can be used while jobs are running.
+func (r *Runner) NewEvaluator(ctx context.Context, instanceName string) (evaluator *Evaluator, err error) {
+	if err = r.validateInstances(); err != nil {
+		return
+	}
+	r.readOnly = true
+	defer r.close()
+	if err = r.open(); err != nil {
+		return
+	}
+	instances := r.instances
+	if instanceName != "" {
+		inst := r.instance(instanceName)
+		if inst == nil {
+			return nil, fmt.Errorf("unknown Transmission instance '%s'", instanceName)
+		}
+		instances = []*instance{inst}
+	}
+	if err = r.loadImports(); err != nil {
+		return
+	}
+	evaluator = &Evaluator{defaultColumns: r.defaultListColumns()}
+	for _, inst := range instances {
+		if err = inst.load(ctx); err != nil {
+			return nil, err
+		}
+		for _, torrent := range inst.allTorrents {
+			evaluator.torrents = append(evaluator.torrents, torrent)
+		}
+	}
+	sort.Slice(evaluator.torrents, func(i, j int) bool {
+		a, b := evaluator.torrents[i], evaluator.torrents[j]
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Name < b.Name
+	})
+	return evaluator, nil
+}
+
+func compileEval(expression string) (program *vm.Program, err error) {
+	program, err = expr.Compile(expression, torrentExprEnv)
+	if err != nil {
+		err = fmt.Errorf("error compiling '%s':\n%+v", expression, err)
+	}
+	return
+}
+
+// Eval evaluates an expression against every loaded torrent.
+func (e *Evaluator) Eval(expression string) (results []EvalResult, err error) {
+	program, err := compileEval(expression)
+	if err != nil {
+		return nil, err
+	}
+	for _, torrent := range e.torrents {
+		output, err := expr.Run(program, &torrentConditionInput{*torrent})
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating '%s' for %s:\n%+v", expression, torrent.Name, err)
+		}
+		results = append(results, EvalResult{Torrent: torrent, Value: output})
+	}
+	return results, nil
+}
+
+// TorrentCompletions returns what can follow "Torrent." in an expression: the fields of TransmissionTorrent, including
+// stored ones, and its methods with a "(" appended.
+func TorrentCompletions() (completions []string) {
+	torrentType := reflect.TypeOf(TransmissionTorrent{})
+	completions = exportedFields(torrentType)
+	for i := 0; i < torrentType.NumMethod(); i++ {
+		completions = append(completions, torrentType.Method(i).Name+"(")
+	}
+	sort.Strings(completions)
+	return
+}
+
+// exportedFields returns the names of a struct's exported fields, including those promoted from embedded structs.
+func exportedFields(structType reflect.Type) (names []string) {
+	seen := make(map[string]bool)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			for _, name := range exportedFields(embedded) {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+			continue
+		}
+		if field.PkgPath == "" && !seen[field.Name] {
+			seen[field.Name] = true
+			names = append(names, field.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,160 @@
+package jobs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/timshannon/bolthold"
+)
+
+func TestRunnerEval(t *testing.T) {
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "bbbb", "second"), fakeTorrent(2, "aaaa", "first"))
+	defer transmission.Close()
+	config := jobs.Config{Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}}}
+	for expression, expected := range map[string][]interface{}{
+		"Torrent.ID == 2":      {true, false},
+		"Torrent.Name + \"!\"": {"first!", "second!"},
+	} {
+		runner := jobs.Runner{Config: config}
+		results, err := runner.Eval(context.Background(), "", expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values []interface{}
+		for _, result := range results {
+			values = append(values, result.Value)
+		}
+		if diff := cmp.Diff(expected, values); diff != "" {
+			t.Errorf("%s: unexpected values (-want +got):\n%s", expression, diff)
+		}
+	}
+	runner := jobs.Runner{Config: config}
+	if _, err := runner.Eval(context.Background(), "", "Torrent.Nope"); err == nil {
+		t.Error("expected an invalid expression to fail to compile")
+	}
+}
+
+func TestRunnerEvalOnlyReadsTheDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "episode"))
+	defer transmission.Close()
+	records := "[]"
+	sonarr := fakeArr(t, "/api/v3/system/status", "/api/v3/history", &records)
+	defer sonarr.Close()
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Sonarr:       &jobs.SonarrSettings{Host: sonarr.URL, APIKey: "deadbeef"},
+	}
+	runner := jobs.Runner{Config: config}
+	if _, err = runner.Eval(context.Background(), "", "Torrent.Imported()"); err != nil {
+		t.Fatalf("expected a database that doesn't exist yet to be skipped: %+v", err)
+	}
+	runner = jobs.Runner{Config: config}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the import is used, but not stored, so it's gone once Sonarr stops returning it
+	for _, history := range []string{arrImportRecords, "[]"} {
+		records = history
+		runner = jobs.Runner{Config: config}
+		results, err := runner.Eval(context.Background(), "", "Torrent.Imported()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported := history != "[]"; len(results) != 1 || results[0].Value != imported {
+			t.Errorf("expected the torrent to be imported to be %t, got %+v", imported, results)
+		}
+	}
+	// a run holds the database open for writing
+	db, err := bolthold.Open(config.DatabasePath, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	runner = jobs.Runner{Config: config}
+	if _, err = runner.Eval(context.Background(), "", "true"); err == nil {
+		t.Error("expected evaluating to give up on a database that's in use")
+	}
+}
+
+func TestTorrentCompletions(t *testing.T) {
+	completions := make(map[string]bool)
+	for _, completion := range jobs.TorrentCompletions() {
+		completions[completion] = true
+	}
+	for completion, expected := range map[string]bool{
+		"Name":        true,
+		"Tags":        true, // stored
+		"Imported(":   true,
+		"ImportedBy(": true,
+		"imports":     false,
+	} {
+		if completions[completion] != expected {
+			t.Errorf("expected completing %s to be %t", completion, expected)
+		}
+	}
+}
+
+func TestEvaluatorList(t *testing.T) {
+	small, large := fakeTorrent(1, "aaaa", "small"), fakeTorrent(2, "bbbb", "large")
+	small["totalSize"], large["totalSize"] = 10, 1000
+	ignored := fakeTorrent(3, "cccc", "ignored")
+	ignored["uploadRatio"] = 5
+	transmission := fakeTransmissionWith(t, small, large, ignored)
+	defer transmission.Close()
+	runner := jobs.Runner{Config: jobs.Config{Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}}}}
+	evaluator, err := runner.NewEvaluator(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing, err := evaluator.List(jobs.ListOptions{
+		Where:   "Torrent.UploadRatio < 1",
+		Columns: []string{"name", `Torrent.Name + "!"`},
+		Sort:    []string{"-size"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &jobs.Listing{
+		Columns: []string{"name", `Torrent.Name + "!"`},
+		Rows:    [][]interface{}{{"large", "large!"}, {"small", "small!"}},
+	}
+	if diff := cmp.Diff(expected, listing); diff != "" {
+		t.Errorf("unexpected listing (-want +got):\n%s", diff)
+	}
+	if _, err = evaluator.List(jobs.ListOptions{Where: "Torrent.Name"}); err == nil {
+		t.Error("expected a where that isn't a condition to fail")
+	}
+}
+
+func TestEvaluatorListDefaultColumns(t *testing.T) {
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "first"))
+	defer transmission.Close()
+	// tags and imported can't be listed without a database or *arr servers
+	runner := jobs.Runner{Config: jobs.Config{Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}}}}
+	evaluator, err := runner.NewEvaluator(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing, err := evaluator.List(jobs.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &jobs.Listing{
+		Columns: []string{"instance", "name", "hash", "status", "ratio"},
+		Rows:    [][]interface{}{{"default", "first", "aaaa", "stopped", 0.0}},
+	}
+	if diff := cmp.Diff(expected, listing); diff != "" {
+		t.Errorf("unexpected listing (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Explanation is why a job's condition did or didn't match a torrent.
+type Explanation struct {
+	Job       string
+	Torrent   *TransmissionTorrent
+	Condition string
+	Skipped   string // why the job doesn't evaluate the torrent at all, if it doesn't
+	Matched   bool
+	Steps     []ExplainStep // the condition, then the sub-expressions it's made of
+	Err       error         // if the condition couldn't be evaluated
+}
+
+// ExplainStep is what one sub-expression of a condition evaluated to.
+type ExplainStep struct {
+	Depth      int // how deeply the sub-expression is nested in and, or and not
+	Expression string
+	Value      interface{}
+	Operands   []interface{} // for comparisons, the values of each side that isn't a literal
+	Err        error
+}
+
+// operatorPrecedence mirrors expr's parser, so that sub-expressions are only parenthesized where they have to be.
+var operatorPrecedence = map[string]int{
+	"or":         10,
+	"||":         10,
+	"and":        15,
+	"&&":         15,
+	"==":         20,
+	"!=":         20,
+	"<":          20,
+	">":          20,
+	">=":         20,
+	"<=":         20,
+	"not in":     20,
+	"in":         20,
+	"matches":    20,
+	"contains":   20,
+	"startsWith": 20,
+	"endsWith":   20,
+	"..":         25,
+	"+":          30,
+	"-":          30,
+	"*":          60,
+	"/":          60,
+	"%":          60,
+	"**":         70,
+}
+
+// Explain evaluates every job's condition against the torrents with a hash, or a prefix of one, showing the value of
+// each sub-expression. Jobs are explained on their own, without earlier jobs removing or moving anything first.
+func (r *Runner) Explain(ctx context.Context, instanceName, hash string) ([]Explanation, error) {
+	evaluator, err := r.NewEvaluator(ctx, instanceName)
+	if err != nil {
+		return nil, err
+	}
+	return evaluator.Explain(r.Config.Jobs, hash)
+}
+
+// Explain evaluates every job's condition against the loaded torrents with a hash, or a prefix of one.
+func (e *Evaluator) Explain(jobs []JobConfig, hash string) (explanations []Explanation, err error) {
+	hash = strings.ToLower(hash)
+	found := false
+	for _, torrent := range e.torrents {
+		if hash == "" || !strings.HasPrefix(strings.ToLower(torrent.HashString), hash) {
+			continue
+		}
+		found = true
+		for _, job := range jobs {
+			explanations = append(explanations, explain(job, torrent))
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no torrent with hash %s", hash)
+	}
+	return explanations, nil
+}
+
+// explain evaluates one job's condition against one torrent.
+func explain(job JobConfig, torrent *TransmissionTorrent) Explanation {
+	explanation := Explanation{Job: job.Name, Torrent: torrent}
+	if job.RemoveOptions == nil && job.TagOptions == nil && job.MigrateOptions == nil {
+		explanation.Skipped = "job doesn't act on existing torrents"
+		return explanation
+	}
+	if !job.runsOn(torrent.Instance) {
+		explanation.Skipped = fmt.Sprintf("job doesn't run on instance '%s'", torrent.Instance)
+		return explanation
+	}
+	explanation.Condition = job.condition()
+	tree, err := parser.Parse(explanation.Condition)
+	if err != nil {
+		explanation.Err = fmt.Errorf("error parsing condition '%s':\n%+v", explanation.Condition, err)
+		return explanation
+	}
+	input := &torrentConditionInput{*torrent}
+	explanation.Steps = explainNode(tree.Node, 0, input)
+	top := explanation.Steps[0]
+	if top.Err != nil {
+		explanation.Err = top.Err
+	} else if matched, ok := top.Value.(bool); ok {
+		explanation.Matched = matched
+	} else {
+		explanation.Err = fmt.Errorf("condition '%s' isn't true or false", explanation.Condition)
+	}
+	return explanation
+}
+
+// runsOn returns whether a job runs on the named instance.
+func (j JobConfig) runsOn(instanceName string) bool {
+	if len(j.Instances) == 0 {
+		return true
+	}
+	for _, name := range j.Instances {
+		if name == instanceName {
+			return true
+		}
+	}
+	return false
+}
+
+// explainNode evaluates a sub-expression, then the sub-expressions that and, or and not are made of.
+func explainNode(node ast.Node, depth int, input *torrentConditionInput) []ExplainStep {
+	step := ExplainStep{Depth: depth, Expression: exprString(node)}
+	step.Value, step.Err = evalNode(node, input)
+	steps := []ExplainStep{step}
+	switch n := node.(type) {
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&", "or", "||":
+			steps = append(steps, explainNode(n.Left, depth+1, input)...)
+			steps = append(steps, explainNode(n.Right, depth+1, input)...)
+			return steps
+		}
+		if operatorPrecedence[n.Operator] == operatorPrecedence["=="] {
+			steps[0].Operands = explainOperands(input, n.Left, n.Right)
+		}
+	case *ast.MatchesNode:
+		steps[0].Operands = explainOperands(input, n.Left, n.Right)
+	case *ast.UnaryNode:
+		if n.Operator == "not" || n.Operator == "!" {
+			steps = append(steps, explainNode(n.Node, depth+1, input)...)
+		}
+	}
+	return steps
+}
+
+// explainOperands evaluates the sides of a comparison that aren't literals, since those speak for themselves.
+func explainOperands(input *torrentConditionInput, operands ...ast.Node) (values []interface{}) {
+	for _, operand := range operands {
+		if isLiteral(operand) {
+			continue
+		}
+		value, err := evalNode(operand, input)
+		if err != nil {
+			value = err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// isLiteral returns whether a node is a literal, or an array of them.
+func isLiteral(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.NilNode, *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.StringNode:
+		return true
+	case *ast.ArrayNode:
+		for _, element := range n.Nodes {
+			if !isLiteral(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func evalNode(node ast.Node, input *torrentConditionInput) (interface{}, error) {
+	expression := exprString(node)
+	program, err := expr.Compile(expression, torrentExprEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling '%s':\n%+v", expression, err)
+	}
+	output, err := expr.Run(program, input)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating '%s':\n%+v", expression, err)
+	}
+	return output, nil
+}
+
+// exprString prints a parsed expression back out as an expression.
+func exprString(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return "nil"
+	case *ast.IdentifierNode:
+		return n.Value
+	case *ast.IntegerNode:
+		return strconv.Itoa(n.Value)
+	case *ast.FloatNode:
+		s := strconv.FormatFloat(n.Value, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	case *ast.BoolNode:
+		return strconv.FormatBool(n.Value)
+	case *ast.StringNode:
+		return strconv.Quote(n.Value)
+	case *ast.ConstantNode:
+		return fmt.Sprintf("%#v", n.Value)
+	case *ast.UnaryNode:
+		operand := exprString(n.Node)
+		switch n.Node.(type) {
+		case *ast.BinaryNode, *ast.MatchesNode, *ast.ConditionalNode:
+			operand = "(" + operand + ")"
+		}
+		if n.Operator == "not" {
+			return "not " + operand
+		}
+		return n.Operator + operand
+	case *ast.BinaryNode:
+		return binaryString(n.Operator, n.Left, n.Right)
+	case *ast.MatchesNode:
+		return binaryString("matches", n.Left, n.Right)
+	case *ast.PropertyNode:
+		return exprString(n.Node) + "." + n.Property
+	case *ast.IndexNode:
+		return exprString(n.Node) + "[" + exprString(n.Index) + "]"
+	case *ast.SliceNode:
+		var from, to string
+		if n.From != nil {
+			from = exprString(n.From)
+		}
+		if n.To != nil {
+			to = exprString(n.To)
+		}
+		return exprString(n.Node) + "[" + from + ":" + to + "]"
+	case *ast.MethodNode:
+		return exprString(n.Node) + "." + n.Method + "(" + exprList(n.Arguments) + ")"
+	case *ast.FunctionNode:
+		return n.Name + "(" + exprList(n.Arguments) + ")"
+	case *ast.BuiltinNode:
+		return n.Name + "(" + exprList(n.Arguments) + ")"
+	case *ast.ClosureNode:
+		return "{" + exprString(n.Node) + "}"
+	case *ast.PointerNode:
+		return "#"
+	case *ast.ConditionalNode:
+		return exprString(n.Cond) + " ? " + exprString(n.Exp1) + " : " + exprString(n.Exp2)
+	case *ast.ArrayNode:
+		return "[" + exprList(n.Nodes) + "]"
+	case *ast.MapNode:
+		return "{" + exprList(n.Pairs) + "}"
+	case *ast.PairNode:
+		return exprString(n.Key) + ": " + exprString(n.Value)
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func exprList(nodes []ast.Node) string {
+	printed := make([]string, len(nodes))
+	for i, node := range nodes {
+		printed[i] = exprString(node)
+	}
+	return strings.Join(printed, ", ")
+}
+
+// binaryString prints a binary operation, parenthesizing either side that would otherwise bind differently.
+func binaryString(operator string, left, right ast.Node) string {
+	precedence := operatorPrecedence[operator]
+	rightAssociative := operator == "**"
+	operand := func(node ast.Node, isLeft bool) string {
+		printed := exprString(node)
+		var childPrecedence int
+		switch n := node.(type) {
+		case *ast.BinaryNode:
+			childPrecedence = operatorPrecedence[n.Operator]
+		case *ast.MatchesNode:
+			childPrecedence = operatorPrecedence["matches"]
+		case *ast.ConditionalNode:
+			return "(" + printed + ")"
+		default:
+			return printed
+		}
+		if childPrecedence < precedence || (childPrecedence == precedence && isLeft == rightAssociative) {
+			return "(" + printed + ")"
+		}
+		return printed
+	}
+	return operand(left, true) + " " + operator + " " + operand(right, false)
+}
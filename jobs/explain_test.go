@@ -0,0 +1,57 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+func TestRunnerExplain(t *testing.T) {
+	seeding := fakeTorrent(1, "ABCD1234", "seeding")
+	seeding["uploadRatio"] = 7.3
+	transmission := fakeTransmissionWith(t, seeding, fakeTorrent(2, "ffff", "other"))
+	defer transmission.Close()
+	runner := jobs.Runner{Config: jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Jobs: []jobs.JobConfig{
+			{
+				Name: "seeded",
+				RemoveOptions: &jobs.RemoveOptions{
+					Condition: `not (Torrent.UploadRatio >= 10.0 || Torrent.Name == "other") && Torrent.ID in [1, 2]`,
+				},
+			},
+			{Name: "feed", FeedOptions: &jobs.FeedOptions{URL: "https://example.com/rss"}},
+			{Name: "elsewhere", Instances: []string{"other"}, TagOptions: &jobs.TagOptions{Condition: "true"}},
+		},
+	}}
+	explanations, err := runner.Explain(context.Background(), "", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []jobs.Explanation{
+		{
+			Job:       "seeded",
+			Condition: `not (Torrent.UploadRatio >= 10.0 || Torrent.Name == "other") && Torrent.ID in [1, 2]`,
+			Matched:   true,
+			Steps: []jobs.ExplainStep{
+				{Depth: 0, Expression: `not (Torrent.UploadRatio >= 10.0 || Torrent.Name == "other") && Torrent.ID in [1, 2]`, Value: true},
+				{Depth: 1, Expression: `not (Torrent.UploadRatio >= 10.0 || Torrent.Name == "other")`, Value: true},
+				{Depth: 2, Expression: `Torrent.UploadRatio >= 10.0 || Torrent.Name == "other"`, Value: false},
+				{Depth: 3, Expression: "Torrent.UploadRatio >= 10.0", Value: false, Operands: []interface{}{7.3}},
+				{Depth: 3, Expression: `Torrent.Name == "other"`, Value: false, Operands: []interface{}{"seeding"}},
+				{Depth: 1, Expression: "Torrent.ID in [1, 2]", Value: true, Operands: []interface{}{int64(1)}},
+			},
+		},
+		{Job: "feed", Skipped: "job doesn't act on existing torrents"},
+		{Job: "elsewhere", Skipped: "job doesn't run on instance 'default'"},
+	}
+	if diff := cmp.Diff(expected, explanations, cmpopts.IgnoreFields(jobs.Explanation{}, "Torrent")); diff != "" {
+		t.Errorf("unexpected explanations (-want +got):\n%s", diff)
+	}
+	if _, err = runner.Explain(context.Background(), "", "0000"); err == nil {
+		t.Error("expected an unknown hash to fail")
+	}
+}
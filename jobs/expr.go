@@ -1,9 +1,11 @@
 package jobs
 
 import (
+	"fmt"
 	"log"
 	"net/url"
 	"path"
+	"strings"
 
 	"github.com/antonmedv/expr"
 )
@@ -16,25 +18,78 @@ type torrentConditionInput struct {
 	Torrent TransmissionTorrent
 }
 
-// Imported returns whether all downloaded files were imported
+// Imported returns whether the torrent was imported by any *arr server
 func (t TransmissionTorrent) Imported() bool {
-	if t.sonarrDropPaths == nil {
-		panic("runtime error: unable to use Imported() without loading imported Sonarr file paths")
+	if t.imports == nil {
+		panic("runtime error: unable to use Imported() without loading *arr import history")
 	}
-	if len(t.Files) == 0 {
-		return false
+	return t.importedBy("")
+}
+
+// ImportedBy returns whether the torrent was imported by a type of *arr server, like "radarr"
+func (t TransmissionTorrent) ImportedBy(arrType string) bool {
+	if t.imports == nil || !t.imports.types[arrType] {
+		panic(fmt.Sprintf("runtime error: unable to use ImportedBy(%q) without configuring a %s server", arrType, arrType))
+	}
+	return t.importedBy(arrType)
+}
+
+// ImportedFraction returns the fraction of the torrent's files that were imported by any *arr server, from 0 to 1.
+// Files count the same way they do for Imported().
+func (t TransmissionTorrent) ImportedFraction() float64 {
+	imported, total, _, _ := t.importedFiles()
+	if total == 0 {
+		return 0
+	}
+	return float64(imported) / float64(total)
+}
+
+// ImportedBytes returns the total size of the torrent's files that were imported by any *arr server
+func (t TransmissionTorrent) ImportedBytes() int64 {
+	_, _, importedBytes, _ := t.importedFiles()
+	return importedBytes
+}
+
+// importedBy returns whether every file that counts was imported. A file was imported if its path was, or if the
+// torrent's info hash, which *arr servers record as the download ID, was imported along with it. A hash imported
+// without knowing which files were, like from a webhook that didn't say, imports all of them, so one episode imported
+// from a season pack doesn't make the whole pack imported but a remote *arr server's imports still count.
+func (t TransmissionTorrent) importedBy(arrType string) bool {
+	importedCount, total, _, _ := t.importedFilesBy(arrType)
+	if total == 0 {
+		return imported(t.imports.hashes[strings.ToLower(t.HashString)], arrType)
+	}
+	return importedCount == total
+}
+
+func (t TransmissionTorrent) importedFiles() (importedCount, total int, importedBytes, totalBytes int64) {
+	if t.imports == nil {
+		panic("runtime error: unable to check imported files without loading *arr import history")
 	}
-	for _, fileData := range t.Files {
+	return t.importedFilesBy("")
+}
+
+// importedFilesBy counts the files that count towards being imported, and how many of them were imported by a type
+// of *arr server, or any of them if arrType is empty.
+func (t TransmissionTorrent) importedFilesBy(arrType string) (importedCount, total int, importedBytes, totalBytes int64) {
+	for i, fileData := range t.Files {
+		// Wanted is only as long as Files when it was fetched
+		wanted := i >= len(t.Wanted) || t.Wanted[i]
+		if !t.imports.counts(fileData.Name, wanted) {
+			continue
+		}
+		total++
+		totalBytes += fileData.Length
 		filePath := path.Join(
 			t.DownloadDir,
 			fileData.Name,
 		)
-		_, exists := t.sonarrDropPaths[filePath]
-		if !exists {
-			return false
+		if imported(t.imports.paths[filePath], arrType) || t.imports.importedFile(t.HashString, fileData.Name, arrType) {
+			importedCount++
+			importedBytes += fileData.Length
 		}
 	}
-	return true
+	return
 }
 
 // AnnounceHostnames returns a list of tracker announce URL hostnames.
@@ -77,6 +132,22 @@ func (s StoredTorrentInfo) SafeToPrune() bool {
 	return true
 }
 
+// addTags adds tags, skipping empty ones and ones it already has.
+func (s *StoredTorrentInfo) addTags(tags ...string) {
+tags:
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		for _, existing := range s.Tags {
+			if existing == tag {
+				continue tags
+			}
+		}
+		s.Tags = append(s.Tags, tag)
+	}
+}
+
 func init() {
 	torrentExprEnv = expr.Env(&torrentConditionInput{})
 }
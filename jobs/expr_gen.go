@@ -85,12 +85,18 @@ type TransmissionTorrent struct {
 
 	*StoredTorrentInfo
 
+	// Synthetic is set for torrents that only exist during a dry run, like feed items that would have been added.
+	Synthetic bool
+
+	// Instance is the name of the Transmission instance the torrent belongs to.
+	Instance string
+
 	// for internal, ephemeral use
-	sonarrDropPaths map[string]bool
+	imports *ImportIndex
 }
 
 // ToTransmissionTorrent converts the library struct to our generated struct.
-func ToTransmissionTorrent(input transmissionrpc.Torrent, sonarrDropPaths map[string]bool) TransmissionTorrent {
+func ToTransmissionTorrent(input transmissionrpc.Torrent, imports *ImportIndex) TransmissionTorrent {
 	return TransmissionTorrent{
 		ActivityDate:            *input.ActivityDate,
 		AddedDate:               *input.AddedDate,
@@ -160,6 +166,6 @@ func ToTransmissionTorrent(input transmissionrpc.Torrent, sonarrDropPaths map[st
 		Wanted:                  input.Wanted,
 		WebSeeds:                input.WebSeeds,
 		WebSeedsSendingToUs:     *input.WebSeedsSendingToUs,
-		sonarrDropPaths:         sonarrDropPaths,
+		imports:                 imports,
 	}
 }
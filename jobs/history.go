@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Actions recorded in HistoryEntry.Action
+const (
+	ActionAdd     = "add"
+	ActionSet     = "set"
+	ActionTag     = "tag"
+	ActionRemove  = "remove"
+	ActionTrash   = "trash"
+	ActionPurge   = "purge"
+	ActionRestore = "restore"
+	ActionMigrate = "migrate"
+)
+
+const historyOutcomeSuccess = "success"
+
+// HistoryEntry is an audit log record of a mutation the runner performed, or would have performed during a dry run.
+type HistoryEntry struct {
+	ID         uint64    `boltholdKey:"ID"`
+	Time       time.Time `boltholdIndex:"Time"`
+	Job        string
+	Instance   string // empty for entries recorded before multiple instances were supported
+	Action     string
+	HashString string
+	Name       string
+	Condition  string // the condition or feed match that triggered the action, if any
+	DryRun     bool
+	Outcome    string // "success", or the RPC error
+}
+
+// InstanceName returns the name of the Transmission instance the entry was recorded for.
+func (e HistoryEntry) InstanceName() string {
+	if e.Instance == "" {
+		return defaultInstanceName
+	}
+	return e.Instance
+}
+
+// HistoryQuery filters HistoryEntry records. Zero values match everything.
+type HistoryQuery struct {
+	Torrent  string // an info hash, or a case-insensitive substring of the torrent name
+	Job      string
+	Instance string
+	Since    time.Time
+	Until    time.Time
+}
+
+// matches covers the filters bolthold can't express with an index.
+func (q HistoryQuery) matches(entry HistoryEntry) bool {
+	if q.Job != "" && q.Job != entry.Job {
+		return false
+	}
+	if q.Instance != "" && q.Instance != entry.InstanceName() {
+		return false
+	}
+	if q.Torrent != "" &&
+		!strings.EqualFold(q.Torrent, entry.HashString) &&
+		!strings.Contains(strings.ToLower(entry.Name), strings.ToLower(q.Torrent)) {
+		return false
+	}
+	return true
+}
+
+// History returns audit log entries from the database at databasePath, oldest first.
+func History(databasePath string, query HistoryQuery) ([]HistoryEntry, error) {
+	db, err := bolthold.Open(databasePath, 0600, &bolthold.Options{
+		Options: &bolt.Options{ReadOnly: true, Timeout: time.Second},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening database @ %s: %+v", databasePath, err)
+	}
+	defer db.Close()
+	boltQuery := bolthold.Where("Time").Ge(query.Since).Index("Time")
+	if !query.Until.IsZero() {
+		boltQuery = boltQuery.And("Time").Le(query.Until)
+	}
+	var entries []HistoryEntry
+	err = db.Find(&entries, boltQuery.SortBy("Time"))
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %+v", err)
+	}
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if query.matches(entry) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+// record saves a HistoryEntry for a mutation performed on a torrent matched by job. Failing to write the audit log is
+// not fatal to the run.
+func (r *instance) record(job JobConfig, action string, torrent *TransmissionTorrent, rpcErr error) {
+	if r.db == nil {
+		return
+	}
+	entry := &HistoryEntry{
+		Time:       time.Now(),
+		Job:        job.Name,
+		Instance:   r.name,
+		Action:     action,
+		HashString: torrent.HashString,
+		Name:       torrent.Name,
+		Condition:  job.condition(),
+		DryRun:     r.DryRun,
+		Outcome:    historyOutcomeSuccess,
+	}
+	if rpcErr != nil {
+		entry.Outcome = rpcErr.Error()
+	}
+	err := r.db.Insert(bolthold.NextSequence(), entry)
+	if err != nil {
+		log.Printf("error recording %s of %s in history: %+v", action, torrent.Name, err)
+	}
+}
@@ -0,0 +1,63 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+	"github.com/timshannon/bolthold"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbPath := path.Join(dir, "db.bbolt")
+	db, err := bolthold.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, entry := range []jobs.HistoryEntry{
+		{Time: now.Add(-48 * time.Hour), Job: "cleanup", Action: jobs.ActionRemove, HashString: "aaaa", Name: "Fedora-35"},
+		{Time: now.Add(-time.Hour), Job: "cleanup", Action: jobs.ActionRemove, HashString: "bbbb", Name: "debian-11"},
+		{Time: now.Add(-time.Minute), Job: "tagger", Action: jobs.ActionTag, HashString: "aaaa", Name: "Fedora-35"},
+	} {
+		entry := entry
+		if err = db.Insert(bolthold.NextSequence(), &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	for name, test := range map[string]struct {
+		query    jobs.HistoryQuery
+		expected []string
+	}{
+		"everything": {jobs.HistoryQuery{}, []string{"Fedora-35", "debian-11", "Fedora-35"}},
+		"by hash":    {jobs.HistoryQuery{Torrent: "AAAA"}, []string{"Fedora-35", "Fedora-35"}},
+		"by name":    {jobs.HistoryQuery{Torrent: "debian"}, []string{"debian-11"}},
+		"by job":     {jobs.HistoryQuery{Job: "tagger"}, []string{"Fedora-35"}},
+		"since":      {jobs.HistoryQuery{Since: now.Add(-2 * time.Hour)}, []string{"debian-11", "Fedora-35"}},
+		"until":      {jobs.HistoryQuery{Until: now.Add(-2 * time.Hour)}, []string{"Fedora-35"}},
+	} {
+		entries, err := jobs.History(dbPath, test.query)
+		if err != nil {
+			t.Errorf("%s: %+v", name, err)
+			continue
+		}
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name
+		}
+		if diff := cmp.Diff(names, test.expected); diff != "" {
+			t.Errorf("%s: %s", name, diff)
+		}
+	}
+}
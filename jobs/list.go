@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+)
+
+// ListOptions describes which torrents to list, and how.
+type ListOptions struct {
+	Where   string   // optional condition torrents must match
+	Columns []string // names from ListColumns, or expressions. Defaults to DefaultListColumns.
+	Sort    []string // columns to sort by, prefixed with - to sort descending. Defaults to instance, then name.
+}
+
+// Listing is a table of torrents.
+type Listing struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// ListColumns are shorthands for common columns. Any other column is evaluated as an expression.
+var ListColumns = map[string]string{
+	"instance":  "Torrent.Instance",
+	"id":        "Torrent.ID",
+	"name":      "Torrent.Name",
+	"hash":      "Torrent.HashString",
+	"status":    "Torrent.Status.String()",
+	"ratio":     "Torrent.UploadRatio",
+	"done":      "Torrent.PercentDone",
+	"size":      "Torrent.TotalSize",
+	"location":  "Torrent.DownloadDir",
+	"added":     "Torrent.AddedDate",
+	"tags":      "Torrent.Tags",
+	"feed_guid": "Torrent.FeedGUID",
+	"imported":  "Torrent.Imported()",
+}
+
+// DefaultListColumns are the columns listed when none are asked for. tags needs a database, and imported needs *arr
+// servers or the webhook, so they're left out without them.
+var DefaultListColumns = []string{"instance", "name", "hash", "status", "ratio", "tags", "imported"}
+
+// defaultListColumns returns the DefaultListColumns that the config can fill in.
+func (r *Runner) defaultListColumns() (columns []string) {
+	for _, column := range DefaultListColumns {
+		if column == "tags" && r.Config.DatabasePath == "" {
+			continue
+		}
+		if column == "imported" && r.imports == nil {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return
+}
+
+// compileColumn compiles a column's expression.
+func compileColumn(column string) (*vm.Program, error) {
+	expression, ok := ListColumns[strings.ToLower(column)]
+	if !ok {
+		expression = column
+	}
+	program, err := expr.Compile(expression, torrentExprEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling column '%s':\n%+v", column, err)
+	}
+	return program, nil
+}
+
+// List lists the loaded torrents that match options.Where, with stored state like tags and feed GUIDs.
+func (e *Evaluator) List(options ListOptions) (*Listing, error) {
+	var (
+		where    *vm.Program
+		err      error
+		columns  = options.Columns
+		sortKeys = options.Sort
+	)
+	if options.Where != "" {
+		if where, err = compileEval(options.Where); err != nil {
+			return nil, err
+		}
+	}
+	if len(columns) == 0 {
+		columns = e.defaultColumns
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = []string{"instance", "name"}
+	}
+	columnPrograms := make([]*vm.Program, len(columns))
+	for i, column := range columns {
+		if columnPrograms[i], err = compileColumn(column); err != nil {
+			return nil, err
+		}
+	}
+	sortPrograms := make([]*vm.Program, len(sortKeys))
+	descending := make([]bool, len(sortKeys))
+	for i, key := range sortKeys {
+		descending[i] = strings.HasPrefix(key, "-")
+		if sortPrograms[i], err = compileColumn(strings.TrimPrefix(key, "-")); err != nil {
+			return nil, err
+		}
+	}
+	type row struct {
+		values, sortValues []interface{}
+	}
+	var rows []row
+	for _, torrent := range e.torrents {
+		input := &torrentConditionInput{*torrent}
+		if where != nil {
+			output, err := expr.Run(where, input)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating '%s' for %s:\n%+v", options.Where, torrent.Name, err)
+			}
+			matched, ok := output.(bool)
+			if !ok {
+				return nil, errors.New("where must be a condition")
+			}
+			if !matched {
+				continue
+			}
+		}
+		var current row
+		if current.values, err = runAll(columnPrograms, input); err != nil {
+			return nil, fmt.Errorf("error listing %s: %+v", torrent.Name, err)
+		}
+		if current.sortValues, err = runAll(sortPrograms, input); err != nil {
+			return nil, fmt.Errorf("error sorting %s: %+v", torrent.Name, err)
+		}
+		rows = append(rows, current)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k := range sortKeys {
+			comparison := compareValues(rows[i].sortValues[k], rows[j].sortValues[k])
+			if comparison != 0 {
+				return (comparison < 0) != descending[k]
+			}
+		}
+		return false
+	})
+	listing := &Listing{Columns: columns}
+	for _, current := range rows {
+		listing.Rows = append(listing.Rows, current.values)
+	}
+	return listing, nil
+}
+
+func runAll(programs []*vm.Program, input *torrentConditionInput) ([]interface{}, error) {
+	values := make([]interface{}, len(programs))
+	for i, program := range programs {
+		output, err := expr.Run(program, input)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = output
+	}
+	return values, nil
+}
+
+// compareValues orders two values of the same column: numbers numerically, times chronologically, false before true,
+// and anything else by how it prints.
+func compareValues(a, b interface{}) int {
+	if aTime, ok := a.(time.Time); ok {
+		if bTime, ok := b.(time.Time); ok {
+			switch {
+			case aTime.Before(bTime):
+				return -1
+			case aTime.After(bTime):
+				return 1
+			}
+			return 0
+		}
+	}
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	if aNumber, ok := number(aValue); ok {
+		if bNumber, ok := number(bValue); ok {
+			switch {
+			case aNumber < bNumber:
+				return -1
+			case aNumber > bNumber:
+				return 1
+			}
+			return 0
+		}
+	}
+	if aValue.Kind() == reflect.Bool && bValue.Kind() == reflect.Bool {
+		switch {
+		case aValue.Bool() == bValue.Bool():
+			return 0
+		case bValue.Bool():
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// number returns a numeric value as a float64, if it is one.
+func number(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/hekmon/transmissionrpc"
+)
+
+const (
+	migrateVerifyTimeout = 6 * time.Hour
+	// migrateVerifyGracePolls is how many polls a requested verification gets to show up as running before we assume
+	// it already finished
+	migrateVerifyGracePolls = 3
+)
+
+// validateMigrate makes sure a migrate job has somewhere to move torrents to.
+func (r *Runner) validateMigrate(job JobConfig) error {
+	to := job.MigrateOptions.To
+	if to == "" {
+		return errors.New("must specify migrate.to")
+	}
+	for _, settings := range r.Config.Transmission {
+		if settings.Name == to {
+			return r.Config.validateNotify(job.MigrateOptions.Notify)
+		}
+	}
+	return fmt.Errorf("unknown migrate.to instance '%s'", to)
+}
+
+func (r *instance) migrate(ctx context.Context, job JobConfig) error {
+	if job.MigrateOptions == nil || job.MigrateOptions.Condition == "" {
+		return errors.New("job has invalid MigrateOptions")
+	}
+	target := r.Runner.instance(job.MigrateOptions.To)
+	if target == nil {
+		return fmt.Errorf("unknown migrate.to instance '%s'", job.MigrateOptions.To)
+	}
+	if target == r {
+		// torrents that are already there have nowhere to go
+		return nil
+	}
+	conditionStr := job.MigrateOptions.Condition
+	conditionProgram, err := expr.Compile(conditionStr, torrentExprEnv)
+	if err != nil {
+		return fmt.Errorf("error compiling condition '%s':\n%+v", conditionStr, err)
+	}
+	for _, torrent := range r.allTorrents {
+		output, err := expr.Run(conditionProgram, &torrentConditionInput{*torrent})
+		if err != nil {
+			return fmt.Errorf("error evaluting condition '%s':\n:%+v", conditionStr, err)
+		}
+		if !output.(bool) {
+			continue
+		}
+		if r.DryRun {
+			log.Printf("DRY RUN: migrate %s to %s", torrent.Name, target.name)
+			r.record(job, ActionMigrate, torrent, nil)
+			r.planTorrent(job, ActionMigrate, torrent)
+			r.notifyArr(job.MigrateOptions.Notify, torrent)
+			r.simulateMigration(torrent, target)
+			continue
+		}
+		err = r.migrateTorrent(ctx, job, torrent, target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTorrent adds a torrent to target with the same download directory, and only removes it from this instance
+// once target has verified the data.
+func (r *instance) migrateTorrent(ctx context.Context, job JobConfig, torrent *TransmissionTorrent, target *instance) error {
+	log.Printf("[+] Migrating %s to %s", torrent.Name, target.name)
+	var (
+		id, existed = target.idOf(torrent.HashString)
+		err         error
+	)
+	if !existed {
+		// stay paused so nothing gets downloaded before the data is verified
+		paused := true
+		payload := &transmissionrpc.TorrentAddPayload{DownloadDir: &torrent.DownloadDir, Paused: &paused}
+		if metaInfo := r.readMetaInfo(torrent); metaInfo != "" {
+			payload.MetaInfo = &metaInfo
+		} else {
+			payload.Filename = &torrent.MagnetLink
+		}
+		var added *transmissionrpc.Torrent
+		added, err = target.client.TorrentAdd(ctx, payload)
+		if added != nil {
+			id = *added.ID
+		}
+	}
+	if err == nil {
+		err = target.verify(ctx, id)
+	}
+	if err == nil {
+		err = target.client.TorrentStart(ctx, []int64{id})
+	}
+	if err != nil {
+		r.record(job, ActionMigrate, torrent, err)
+		if id != 0 && !existed {
+			// the data is shared with this instance, so it must stay put
+			removeErr := target.client.TorrentRemove(ctx, &transmissionrpc.TorrentRemovePayload{IDs: []int64{id}})
+			if removeErr != nil {
+				log.Printf("[*] could not remove failed migration of %s from %s: %+v", torrent.Name, target.name, removeErr)
+			}
+		}
+		return fmt.Errorf("error migrating %s to %s: %+v", torrent.Name, target.name, err)
+	}
+	err = r.client.TorrentRemove(ctx, &transmissionrpc.TorrentRemovePayload{IDs: []int64{torrent.ID}})
+	r.record(job, ActionMigrate, torrent, err)
+	if err != nil {
+		return fmt.Errorf("%s was migrated to %s, but could not be removed from %s: %+v", torrent.Name, target.name, r.name, err)
+	}
+	r.notifyArr(job.MigrateOptions.Notify, torrent)
+	torrents, err := target.client.TorrentGet(ctx, allTorrentFields, []int64{id})
+	if err != nil || len(torrents) != 1 {
+		return fmt.Errorf("error getting migrated torrent %s from %s: %+v", torrent.Name, target.name, err)
+	}
+	migrated := ToTransmissionTorrent(*torrents[0], r.imports)
+	migrated.Instance = target.name
+	if torrent.StoredTorrentInfo != nil {
+		stored := migrated.GetOrCreateStored()
+		stored.FeedGUID = torrent.FeedGUID
+		stored.Tags = append([]string{}, torrent.Tags...)
+	}
+	target.allTorrents[id] = &migrated
+	return r.forget(torrent.ID)
+}
+
+// idOf returns the ID of the torrent with an info hash, if this instance has it.
+func (r *instance) idOf(hash string) (int64, bool) {
+	for id, torrent := range r.allTorrents {
+		if torrent.HashString == hash && !torrent.Synthetic {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// verify rechecks a paused torrent's data and waits for it to be complete. Magnets fetch their metadata first, which
+// they can only do while running, so they're only started until it arrives.
+func (r *instance) verify(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, migrateVerifyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(r.client.pollInterval)
+	defer ticker.Stop()
+	var (
+		started, requested, checked bool
+		idlePolls                   int
+	)
+	for {
+		torrents, err := r.client.TorrentGet(
+			ctx, []string{"status", "percentDone", "metadataPercentComplete", "error", "errorString"}, []int64{id},
+		)
+		if err != nil {
+			return fmt.Errorf("error checking on torrent ID %d: %+v", id, err)
+		}
+		if len(torrents) != 1 {
+			return fmt.Errorf("torrent ID %d disappeared while verifying", id)
+		}
+		torrent := torrents[0]
+		if torrent.Error != nil && *torrent.Error != 0 {
+			return fmt.Errorf("error verifying torrent ID %d: %s", id, *torrent.ErrorString)
+		}
+		status := *torrent.Status
+		switch {
+		case *torrent.MetadataPercentComplete < 1:
+			if !started {
+				if err = r.client.TorrentStart(ctx, []int64{id}); err != nil {
+					return fmt.Errorf("error fetching metadata for torrent ID %d: %+v", id, err)
+				}
+				started = true
+			}
+		case !requested:
+			if started {
+				if err = r.client.TorrentStop(ctx, []int64{id}); err != nil {
+					return fmt.Errorf("error stopping torrent ID %d to verify it: %+v", id, err)
+				}
+			}
+			err = r.client.TorrentVerify(ctx, []int64{id})
+			if err != nil {
+				return fmt.Errorf("error verifying torrent ID %d: %+v", id, err)
+			}
+			requested = true
+		case status == transmissionrpc.TorrentStatusCheckWait || status == transmissionrpc.TorrentStatusCheck:
+			checked = true
+		case checked || idlePolls >= migrateVerifyGracePolls:
+			if *torrent.PercentDone < 1 {
+				return fmt.Errorf("torrent ID %d is only %.1f%% complete after verifying", id, *torrent.PercentDone*100)
+			}
+			return nil
+		default:
+			idlePolls++
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for torrent ID %d to verify: %+v", id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// simulateMigration moves a torrent to a synthetic copy on target during a dry run, so that later jobs can see it.
+func (r *instance) simulateMigration(torrent *TransmissionTorrent, target *instance) {
+	r.lastSyntheticID--
+	migrated := *torrent
+	migrated.ID = r.lastSyntheticID
+	migrated.Instance = target.name
+	migrated.Synthetic = true
+	if torrent.StoredTorrentInfo != nil {
+		stored := *torrent.StoredTorrentInfo
+		stored.ID = migrated.ID
+		migrated.StoredTorrentInfo = &stored
+	}
+	target.allTorrents[migrated.ID] = &migrated
+	delete(r.allTorrents, torrent.ID)
+}
@@ -0,0 +1,102 @@
+package jobs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+// migrateTestConfig migrates every torrent from the instance "a" to "b".
+func migrateTestConfig(dir, sourceURL, targetURL string) jobs.Config {
+	return jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{
+			{Name: "a", Host: sourceURL, PollInterval: time.Millisecond},
+			{Name: "b", Host: targetURL, PollInterval: time.Millisecond},
+		},
+		Jobs: []jobs.JobConfig{{
+			Name:           "migrate",
+			Instances:      []string{"a"},
+			MigrateOptions: &jobs.MigrateOptions{To: "b", Condition: "true"},
+		}},
+	}
+}
+
+func TestRunnerMigratesTorrents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, magnet := trashTestTorrents(t, dir)
+	for name, test := range map[string]struct {
+		torrent     map[string]interface{}
+		percentDone float64
+		fromFile    bool
+		succeeds    bool
+		target      []string
+		source      []string
+	}{
+		"verified": {
+			withFile, 1, true, true,
+			[]string{"torrent-add dir=/downloads paused=true", "torrent-verify [100]", "torrent-start [100]"},
+			[]string{"torrent-remove [1] delete=false"},
+		},
+		"incomplete": {
+			withFile, 0.5, true, false,
+			[]string{"torrent-add dir=/downloads paused=true", "torrent-verify [100]", "torrent-remove [100] delete=false"},
+			nil,
+		},
+		"magnet": {
+			magnet, 1, false, true,
+			[]string{
+				"torrent-add dir=/downloads paused=true",
+				"torrent-start [100]",
+				"torrent-stop [100]",
+				"torrent-verify [100]",
+				"torrent-start [100]",
+			},
+			[]string{"torrent-remove [2] delete=false"},
+		},
+	} {
+		torrent := make(map[string]interface{})
+		for key, value := range test.torrent {
+			torrent[key] = value
+		}
+		source, target := newFakeTransmissionState(t, torrent), newFakeTransmissionState(t)
+		var fromFile bool
+		target.add = func(arguments fakeRPCArguments) (map[string]interface{}, bool) {
+			fromFile = arguments.MetaInfo != ""
+			added := fakeTorrent(100, torrent["hashString"].(string), torrent["name"].(string))
+			added["percentDone"] = test.percentDone
+			if fromFile {
+				added["metadataPercentComplete"] = 1
+			}
+			return added, false
+		}
+		runner := jobs.Runner{Config: migrateTestConfig(path.Join(dir, name), source.URL, target.URL)}
+		if err = os.Mkdir(path.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = runner.Run(context.Background()); (err == nil) != test.succeeds {
+			t.Errorf("%s: expected success to be %t, got %+v", name, test.succeeds, err)
+		}
+		if fromFile != test.fromFile {
+			t.Errorf("%s: expected adding from the .torrent file to be %t", name, test.fromFile)
+		}
+		if diff := cmp.Diff(test.target, target.calls); diff != "" {
+			t.Errorf("%s: unexpected calls to the target (-want +got):\n%s", name, diff)
+		}
+		if diff := cmp.Diff(test.source, source.calls); diff != "" {
+			t.Errorf("%s: unexpected calls to the source (-want +got):\n%s", name, diff)
+		}
+		source.Close()
+		target.Close()
+	}
+}
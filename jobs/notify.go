@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const arrQueuePageSize = 100
+
+// arrMedia identifies the series, movie, artist or author that a queue item or history record is for. Legacy APIs
+// nest series and movies instead.
+type arrMedia struct {
+	SeriesID int64
+	MovieID  int64
+	ArtistID int64
+	AuthorID int64
+	Series   *struct{ ID int64 }
+	Movie    *struct{ ID int64 }
+}
+
+// id returns the ID of the media, or 0 if it isn't known.
+func (m arrMedia) id() int64 {
+	for _, id := range []int64{m.SeriesID, m.MovieID, m.ArtistID, m.AuthorID} {
+		if id != 0 {
+			return id
+		}
+	}
+	if m.Series != nil {
+		return m.Series.ID
+	} else if m.Movie != nil {
+		return m.Movie.ID
+	}
+	return 0
+}
+
+type arrQueueItem struct {
+	ID         int64
+	DownloadID string
+	arrMedia
+}
+
+type arrQueueResponse struct {
+	Page         int
+	PageSize     int
+	TotalRecords int
+	Records      []arrQueueItem
+}
+
+// arrRescanCommands are the commands that rescan the files of a series, movie, artist or author, and the name of the
+// ID they take.
+var arrRescanCommands = map[string][2]string{
+	ArrSonarr:  {"RescanSeries", "seriesId"},
+	ArrRadarr:  {"RescanMovie", "movieId"},
+	ArrLidarr:  {"RefreshArtist", "artistId"},
+	ArrReadarr: {"RefreshAuthor", "authorId"},
+}
+
+// queueItem returns the queue item that is downloading a torrent, or nil if there isn't one.
+func (c *arrClient) queueItem(hash string) (*arrQueueItem, error) {
+	var items []arrQueueItem
+	if c.legacy {
+		if _, err := c.get("/queue", nil, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		for page := 1; ; page++ {
+			query := url.Values{}
+			query.Set("page", strconv.Itoa(page))
+			query.Set("pageSize", strconv.Itoa(arrQueuePageSize))
+			var queue arrQueueResponse
+			if _, err := c.get("/queue", query, &queue); err != nil {
+				return nil, err
+			}
+			items = append(items, queue.Records...)
+			if len(queue.Records) == 0 || page*arrQueuePageSize >= queue.TotalRecords {
+				break
+			}
+		}
+	}
+	for i := range items {
+		if strings.EqualFold(items[i].DownloadID, hash) {
+			return &items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// removeFromQueue removes a queue item, leaving the torrent alone. Sonarr v3 calls blocklisting blacklisting.
+func (c *arrClient) removeFromQueue(item *arrQueueItem, blocklist bool) error {
+	query := url.Values{}
+	query.Set("removeFromClient", "false")
+	query.Set("blocklist", strconv.FormatBool(blocklist))
+	query.Set("blacklist", strconv.FormatBool(blocklist))
+	_, err := c.request(http.MethodDelete, fmt.Sprintf("/queue/%d", item.ID), query, nil, nil)
+	return err
+}
+
+// media finds what a torrent was downloaded for in history, for torrents that have left the queue.
+func (c *arrClient) media(hash string) (media arrMedia, err error) {
+	query := url.Values{}
+	query.Set("downloadId", hash)
+	query.Set("pageSize", strconv.Itoa(arrHistoryPageSize))
+	var history arrHistoryResponse
+	if _, err = c.get("/history", query, &history); err != nil {
+		return
+	}
+	// servers that can't filter by download ID return recent history instead
+	for _, record := range history.Records {
+		if strings.EqualFold(record.DownloadID, hash) && record.id() != 0 {
+			return record.arrMedia, nil
+		}
+	}
+	return
+}
+
+// rescan rescans the files of a series, movie, artist or author.
+func (c *arrClient) rescan(media arrMedia) error {
+	command := arrRescanCommands[c.arrType]
+	body := map[string]interface{}{"name": command[0], command[1]: media.id()}
+	_, err := c.request(http.MethodPost, "/command", nil, body, nil)
+	return err
+}
+
+// arrClient returns a client for an *arr server, reusing it across notifications.
+func (r *Runner) arrClient(settings ArrSettings) (*arrClient, error) {
+	source := settings.source()
+	if client, ok := r.arrClients[source]; ok {
+		return client, nil
+	}
+	client, err := newArrClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	if r.arrClients == nil {
+		r.arrClients = make(map[string]*arrClient)
+	}
+	r.arrClients[source] = client
+	return client, nil
+}
+
+// notifyArr tells every *arr server that downloaded a torrent that a job moved or removed it. Transmission has already
+// been changed by then, so failures are only logged.
+func (r *Runner) notifyArr(notify []string, torrent *TransmissionTorrent) {
+	if len(notify) == 0 {
+		return
+	}
+	if r.DryRun {
+		log.Printf("DRY RUN: notify *arr servers about %s: %s", torrent.Name, strings.Join(notify, ", "))
+		return
+	}
+	for _, settings := range r.Config.arrSources() {
+		if err := r.notifyArrSource(settings, notify, torrent); err != nil {
+			log.Printf("[*] could not notify %s about %s: %+v", settings.Host, torrent.Name, err)
+		}
+	}
+}
+
+func (r *Runner) notifyArrSource(settings ArrSettings, notify []string, torrent *TransmissionTorrent) error {
+	client, err := r.arrClient(settings)
+	if err != nil {
+		return err
+	}
+	item, err := client.queueItem(torrent.HashString)
+	if err != nil {
+		return fmt.Errorf("error getting queue: %+v", err)
+	}
+	var removeFromQueue, blocklist, rescan bool
+	for _, notification := range notify {
+		switch notification {
+		case NotifyRemoveFromQueue:
+			removeFromQueue = true
+		case NotifyBlocklist:
+			blocklist = true
+		case NotifyRescan:
+			rescan = true
+		}
+	}
+	if item != nil && (removeFromQueue || blocklist) {
+		log.Printf("[+] Removing %s from the %s queue", torrent.Name, settings.Type)
+		if err = client.removeFromQueue(item, blocklist); err != nil {
+			return fmt.Errorf("error removing from queue: %+v", err)
+		}
+	}
+	if !rescan {
+		return nil
+	}
+	var media arrMedia
+	if item != nil {
+		media = item.arrMedia
+	} else if media, err = client.media(torrent.HashString); err != nil {
+		return fmt.Errorf("error getting history: %+v", err)
+	}
+	if media.id() == 0 {
+		// this server didn't download it
+		return nil
+	}
+	log.Printf("[+] Rescanning %s in %s", torrent.Name, settings.Type)
+	if err = client.rescan(media); err != nil {
+		return fmt.Errorf("error rescanning: %+v", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+// fakeRadarr answers the *arr calls that notifications make, recording the ones that act.
+func fakeRadarr(t *testing.T, calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v3/system/status":
+			w.Write([]byte(`{"version": "5.0.0.0"}`))
+		case "GET /api/v3/history":
+			w.Write([]byte(`{"records": []}`))
+		case "GET /api/v3/queue":
+			w.Write([]byte(`{"page": 1, "totalRecords": 2, "records": [
+				{"id": 6, "downloadId": "BBBB", "movieId": 2},
+				{"id": 7, "downloadId": "AAAA", "movieId": 3}
+			]}`))
+		case "DELETE /api/v3/queue/7":
+			*calls = append(*calls, "remove blocklist="+r.URL.Query().Get("blocklist"))
+		case "POST /api/v3/command":
+			var command struct {
+				Name    string
+				MovieID int64
+			}
+			if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			*calls = append(*calls, fmt.Sprintf("%s %d", command.Name, command.MovieID))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRunnerNotifiesArr(t *testing.T) {
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "movie"))
+	defer transmission.Close()
+	var calls []string
+	radarr := fakeRadarr(t, &calls)
+	defer radarr.Close()
+	runner := jobs.Runner{Config: jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Arr:          []jobs.ArrSettings{{Type: jobs.ArrRadarr, Host: radarr.URL}},
+		Jobs: []jobs.JobConfig{{
+			Name: "remove movie",
+			RemoveOptions: &jobs.RemoveOptions{
+				Condition: `Torrent.Name == "movie"`,
+				Notify:    []string{jobs.NotifyBlocklist, jobs.NotifyRescan},
+			},
+		}},
+	}}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"remove blocklist=true", "RescanMovie 3"}, calls); diff != "" {
+		t.Errorf("unexpected *arr calls (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunnerAppliesNotifications(t *testing.T) {
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "movie"))
+	defer transmission.Close()
+	var calls []string
+	radarr := fakeRadarr(t, &calls)
+	defer radarr.Close()
+	config := jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Arr:          []jobs.ArrSettings{{Type: jobs.ArrRadarr, Host: radarr.URL}},
+		Jobs: []jobs.JobConfig{{
+			Name: "remove movie",
+			RemoveOptions: &jobs.RemoveOptions{
+				Condition: `Torrent.Name == "movie"`,
+				Notify:    []string{jobs.NotifyRescan},
+			},
+		}},
+	}
+	plan := &jobs.Plan{}
+	runner := jobs.Runner{Config: config, DryRun: true, Plan: plan}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// plans are applied from JSON
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded jobs.Plan
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	runner = jobs.Runner{Config: config}
+	if err = runner.Apply(context.Background(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"RescanMovie 3"}, calls); diff != "" {
+		t.Errorf("unexpected *arr calls (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,366 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/timshannon/bolthold"
+)
+
+// Plan is a machine-readable list of the actions a dry run would have taken, which can be reviewed and applied later.
+type Plan struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Actions   []PlannedAction `json:"actions"`
+}
+
+// PlannedAction is a single action in a Plan. Which fields are set depends on Action.
+type PlannedAction struct {
+	Job      string          `json:"job"`
+	Instance string          `json:"instance,omitempty"` // the Transmission instance, or the default one if empty
+	Action   string          `json:"action"`
+	Reason   string          `json:"reason,omitempty"`  // the condition or feed match that triggered the action
+	Torrent  *PlannedTorrent `json:"torrent,omitempty"` // for actions on existing torrents
+	Feed     *PlannedFeed    `json:"feed,omitempty"`    // for adds from feeds and searches
+	File     string          `json:"file,omitempty"`    // for adds from watch directories
+
+	DeleteLocal bool     `json:"delete_local,omitempty"`
+	Location    string   `json:"location,omitempty"`  // trash location for trashes, download directory for adds
+	Retention   string   `json:"retention,omitempty"` // for trashes
+	Tag         string   `json:"tag,omitempty"`
+	To          string   `json:"to,omitempty"` // instance to migrate to
+	SeedRatio   float64  `json:"seed_ratio,omitempty"`
+	Notify      []string `json:"notify,omitempty"` // for removes, trashes and migrations
+}
+
+// PlannedTorrent is the state of a torrent when it was planned for, which is compared against when applying.
+type PlannedTorrent struct {
+	ID          int64    `json:"id"`
+	HashString  string   `json:"hash"`
+	Name        string   `json:"name"`
+	Status      string   `json:"status"`
+	DownloadDir string   `json:"download_dir"`
+	Tags        []string `json:"tags"`
+}
+
+// PlannedFeed is a feed item that was planned to be added.
+type PlannedFeed struct {
+	URL   string `json:"url"`
+	GUID  string `json:"guid"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+func newPlannedTorrent(torrent *TransmissionTorrent) *PlannedTorrent {
+	planned := &PlannedTorrent{
+		ID:          torrent.ID,
+		HashString:  torrent.HashString,
+		Name:        torrent.Name,
+		Status:      torrent.Status.String(),
+		DownloadDir: torrent.DownloadDir,
+	}
+	if torrent.StoredTorrentInfo != nil {
+		planned.Tags = append([]string{}, torrent.Tags...)
+	}
+	return planned
+}
+
+// drifted describes how a torrent differs from when it was planned for, or returns "" if it hasn't.
+func (p PlannedTorrent) drifted(torrent *TransmissionTorrent, tags []string) string {
+	if torrent == nil {
+		return "no longer exists"
+	}
+	var changes []string
+	if status := torrent.Status.String(); status != p.Status {
+		changes = append(changes, fmt.Sprintf("status %s -> %s", p.Status, status))
+	}
+	if torrent.DownloadDir != p.DownloadDir {
+		changes = append(changes, fmt.Sprintf("download dir %s -> %s", p.DownloadDir, torrent.DownloadDir))
+	}
+	if !sameTags(p.Tags, tags) {
+		changes = append(changes, fmt.Sprintf("tags %v -> %v", p.Tags, tags))
+	}
+	return strings.Join(changes, ", ")
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// job rebuilds enough of the JobConfig that planned an action to perform it.
+func (a PlannedAction) job() (job JobConfig, err error) {
+	job.Name = a.Job
+	switch a.Action {
+	case ActionRemove:
+		job.RemoveOptions = &RemoveOptions{Condition: a.Reason, DeleteLocal: a.DeleteLocal, Notify: a.Notify}
+	case ActionTrash:
+		trash := &TrashOptions{Location: a.Location}
+		if trash.Retention, err = time.ParseDuration(a.Retention); err != nil {
+			return job, fmt.Errorf("invalid retention: %+v", err)
+		}
+		job.RemoveOptions = &RemoveOptions{Condition: a.Reason, Trash: trash, Notify: a.Notify}
+	case ActionTag:
+		job.TagOptions = &TagOptions{Name: a.Tag, Condition: a.Reason}
+	case ActionMigrate:
+		job.MigrateOptions = &MigrateOptions{To: a.To, Condition: a.Reason, Notify: a.Notify}
+	case ActionAdd:
+		job.Location = a.Location
+		job.SeedRatio = a.SeedRatio
+		if a.Feed != nil {
+			job.FeedOptions = &FeedOptions{URL: a.Feed.URL, Tag: a.Tag}
+		} else if a.File != "" {
+			job.WatchOptions = &WatchOptions{Directory: filepath.Dir(a.File), Tag: a.Tag}
+		} else {
+			return job, errors.New("add is missing its feed item or file")
+		}
+	default:
+		return job, fmt.Errorf("unknown action '%s'", a.Action)
+	}
+	if a.Action != ActionAdd && a.Torrent == nil {
+		return job, fmt.Errorf("%s is missing its torrent", a.Action)
+	}
+	return job, nil
+}
+
+// planTorrent adds an action on an existing torrent to the plan, if one is being made. Synthetic torrents don't exist
+// yet, so there's nothing to apply actions on them to.
+func (r *instance) planTorrent(job JobConfig, action string, torrent *TransmissionTorrent) {
+	if r.Plan == nil || torrent.Synthetic {
+		return
+	}
+	planned := PlannedAction{
+		Job:      job.Name,
+		Instance: r.name,
+		Action:   action,
+		Reason:   job.condition(),
+		Torrent:  newPlannedTorrent(torrent),
+	}
+	switch action {
+	case ActionRemove:
+		planned.DeleteLocal = job.RemoveOptions.DeleteLocal
+		planned.Notify = job.RemoveOptions.Notify
+	case ActionTrash:
+		planned.Location = job.RemoveOptions.Trash.Location
+		planned.Retention = job.RemoveOptions.Trash.Retention.String()
+		planned.Notify = job.RemoveOptions.Notify
+	case ActionTag:
+		planned.Tag = job.TagOptions.Name
+	case ActionMigrate:
+		planned.To = job.MigrateOptions.To
+		planned.Notify = job.MigrateOptions.Notify
+	}
+	r.Plan.Actions = append(r.Plan.Actions, planned)
+}
+
+// planFeedItem adds a feed item to the plan, if one is being made.
+func (r *instance) planFeedItem(job JobConfig, item *gofeed.Item) {
+	if r.Plan == nil {
+		return
+	}
+	r.Plan.Actions = append(r.Plan.Actions, PlannedAction{
+		Job:      job.Name,
+		Instance: r.name,
+		Action:   ActionAdd,
+		Reason:   job.condition(),
+		Feed: &PlannedFeed{
+			URL:   job.FeedOptions.URL,
+			GUID:  item.GUID,
+			Title: item.Title,
+			Link:  item.Link,
+		},
+		Location:  job.Location,
+		Tag:       job.FeedOptions.Tag,
+		SeedRatio: job.SeedRatio,
+	})
+}
+
+// planWatchedFile adds a watched file to the plan, if one is being made.
+func (r *instance) planWatchedFile(job JobConfig, file string) {
+	if r.Plan == nil {
+		return
+	}
+	r.Plan.Actions = append(r.Plan.Actions, PlannedAction{
+		Job:       job.Name,
+		Instance:  r.name,
+		Action:    ActionAdd,
+		File:      file,
+		Location:  job.Location,
+		Tag:       job.WatchOptions.Tag,
+		SeedRatio: job.SeedRatio,
+	})
+}
+
+// Apply performs exactly the actions in a plan, refusing to do anything if the torrents it covers have drifted since
+// it was made.
+func (r *Runner) Apply(ctx context.Context, plan *Plan) (err error) {
+	if err = r.validateInstances(); err != nil {
+		return
+	}
+	defer r.close()
+	if err = r.open(); err != nil {
+		return
+	}
+	for i, action := range plan.Actions {
+		if r.instance(action.Instance) == nil {
+			return fmt.Errorf("invalid action %d: unknown Transmission instance '%s'", i, action.Instance)
+		}
+	}
+	var drifted, instanceDrifted []string
+	for _, inst := range r.instances {
+		if err = inst.load(ctx); err != nil {
+			return
+		}
+		instanceDrifted, err = inst.checkDrift(plan)
+		if err != nil {
+			return
+		}
+		drifted = append(drifted, instanceDrifted...)
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("refusing to apply plan, torrent state has drifted:\n%s", strings.Join(drifted, "\n"))
+	}
+	if r.DryRun {
+		log.Println("[*] Dry run mode - no changes will be made")
+	}
+	for i, action := range plan.Actions {
+		err = r.instance(action.Instance).apply(ctx, action)
+		if err != nil {
+			return fmt.Errorf("error applying action %d (%s by '%s'): %+v", i, action.Action, action.Job, err)
+		}
+	}
+	if r.db != nil && !r.DryRun {
+		for _, inst := range r.instances {
+			if err = inst.save(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// checkDrift describes every action in the plan for this instance that no longer applies to the torrent state it was
+// planned against.
+func (r *instance) checkDrift(plan *Plan) (drifted []string, err error) {
+	var (
+		byHash = make(map[string]*TransmissionTorrent, len(r.allTorrents))
+		tags   = make(map[string][]string, len(r.allTorrents))
+	)
+	for _, torrent := range r.allTorrents {
+		byHash[torrent.HashString] = torrent
+		if torrent.StoredTorrentInfo != nil {
+			tags[torrent.HashString] = append([]string{}, torrent.Tags...)
+		}
+	}
+	for i, action := range plan.Actions {
+		if r.Runner.instance(action.Instance) != r {
+			continue
+		}
+		if _, err := action.job(); err != nil {
+			return nil, fmt.Errorf("invalid action %d: %+v", i, err)
+		}
+		if action.Action == ActionAdd && action.File != "" {
+			if _, err := os.Stat(action.File); err != nil {
+				drifted = append(drifted, fmt.Sprintf("%s: no longer watched", action.File))
+			}
+			continue
+		} else if action.Action == ActionAdd {
+			if r.db == nil {
+				continue
+			}
+			var stored StoredTorrentInfo
+			err := r.store.FindOne(&stored, bolthold.Where("FeedGUID").Eq(action.Feed.GUID).Index("FeedGUID"))
+			if err == nil {
+				drifted = append(drifted, fmt.Sprintf("%s: already added", action.Feed.Title))
+			} else if err != bolthold.ErrNotFound {
+				return nil, fmt.Errorf("error checking if %s is downloaded: %+v", action.Feed.GUID, err)
+			}
+			continue
+		}
+		hash := action.Torrent.HashString
+		// earlier actions in the plan change what later ones see, so play them forward as we go
+		if reason := action.Torrent.drifted(byHash[hash], tags[hash]); reason != "" {
+			drifted = append(drifted, fmt.Sprintf("%s: %s", action.Torrent.Name, reason))
+		}
+		switch action.Action {
+		case ActionTag:
+			tags[hash] = append(tags[hash], action.Tag)
+		case ActionRemove, ActionTrash, ActionMigrate:
+			delete(byHash, hash)
+		}
+	}
+	return drifted, nil
+}
+
+func (r *instance) apply(ctx context.Context, action PlannedAction) error {
+	job, err := action.job()
+	if err != nil {
+		return err
+	}
+	if action.Action == ActionAdd && action.File != "" {
+		if r.DryRun {
+			log.Printf("DRY RUN: would add %s", action.File)
+			return nil
+		}
+		return r.addWatchedFile(ctx, job, action.File)
+	} else if action.Action == ActionAdd {
+		if r.DryRun {
+			log.Printf("DRY RUN: would add feed item: %s (%s)", action.Feed.Title, action.Feed.Link)
+			return nil
+		}
+		return r.addFeedItem(ctx, job, &gofeed.Item{
+			GUID:  action.Feed.GUID,
+			Title: action.Feed.Title,
+			Link:  action.Feed.Link,
+		})
+	}
+	var torrent *TransmissionTorrent
+	for _, candidate := range r.allTorrents {
+		if candidate.HashString == action.Torrent.HashString {
+			torrent = candidate
+			break
+		}
+	}
+	if torrent == nil {
+		return fmt.Errorf("%s no longer exists", action.Torrent.Name)
+	}
+	switch action.Action {
+	case ActionTag:
+		r.tagTorrent(job, torrent)
+	case ActionRemove, ActionTrash:
+		if r.DryRun {
+			log.Printf("DRY RUN: %s %s", action.Action, torrent.Name)
+			return nil
+		}
+		return r.removeTorrents(ctx, job, []int64{torrent.ID})
+	case ActionMigrate:
+		target := r.Runner.instance(job.MigrateOptions.To)
+		if target == nil {
+			return fmt.Errorf("unknown Transmission instance '%s'", job.MigrateOptions.To)
+		}
+		if r.DryRun {
+			log.Printf("DRY RUN: migrate %s to %s", torrent.Name, target.name)
+			return nil
+		}
+		return r.migrateTorrent(ctx, job, torrent, target)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hekmon/transmissionrpc"
+)
+
+const (
+	defaultRPCPath      = "/transmission/rpc"
+	defaultRPCTimeout   = 30 * time.Second
+	defaultRPCRetries   = 3
+	defaultRPCBackoff   = time.Second
+	defaultPollInterval = 2 * time.Second
+	rpcSessionIDHeader  = "X-Transmission-Session-Id"
+	rpcUserAgent        = "github.com/mark-ignacio/transmission-jobs"
+	rpcResultSuccess    = "success"
+	rpcMethodTorrentGet = "torrent-get"
+)
+
+var (
+	allTorrentFields []string
+	// idempotentMethods can be safely retried, since doing them twice is the same as doing them once.
+	idempotentMethods = map[string]bool{
+		rpcMethodTorrentGet:    true,
+		"session-get":          true,
+		"torrent-set":          true,
+		"torrent-set-location": true,
+		"torrent-verify":       true,
+		"torrent-start":        true,
+		"torrent-stop":         true,
+	}
+)
+
+func init() {
+	torrentType := reflect.TypeOf(transmissionrpc.Torrent{})
+	for i := 0; i < torrentType.NumField(); i++ {
+		allTorrentFields = append(allTorrentFields, torrentType.Field(i).Tag.Get("json"))
+	}
+}
+
+// TransmissionClient is a context-aware Transmission RPC client with per-call timeouts and retries. It reuses
+// transmissionrpc's types, but transmissionrpc.Client can't take a context.
+type TransmissionClient struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	// pollInterval is how often to check on torrents that are moving or verifying
+	pollInterval time.Duration
+
+	sessionIDLock sync.RWMutex
+	sessionID     string
+}
+
+// AmbiguousError is returned when a call that isn't safe to retry failed after Transmission may have already acted on
+// it, e.g. a torrent-add that timed out. Check on the torrent before trying again.
+type AmbiguousError struct {
+	Method string
+	Err    error
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("'%s' may or may not have taken effect: %+v", e.Method, e.Err)
+}
+
+func (e *AmbiguousError) Unwrap() error {
+	return e.Err
+}
+
+// rpcStatusError is an HTTP error response that isn't a session ID refresh.
+type rpcStatusError struct {
+	StatusCode int
+}
+
+func (e *rpcStatusError) Error() string {
+	return fmt.Sprintf("HTTP error %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// rpcResultError is a call that Transmission answered, but didn't succeed at.
+type rpcResultError struct {
+	Result string
+}
+
+func (e *rpcResultError) Error() string {
+	return fmt.Sprintf("RPC call did not succeed: %s", e.Result)
+}
+
+type rpcRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments,omitempty"`
+	Tag       int         `json:"tag"`
+}
+
+type rpcResponse struct {
+	Arguments interface{} `json:"arguments"`
+	Result    string      `json:"result"`
+	Tag       *int        `json:"tag"`
+}
+
+// call performs an RPC call, retrying idempotent calls with exponential backoff.
+func (c *TransmissionClient) call(ctx context.Context, method string, arguments, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, method, arguments, result)
+		if err == nil {
+			return nil
+		}
+		if !idempotentMethods[method] {
+			if outcomeUnknown(err) {
+				return &AmbiguousError{Method: method, Err: err}
+			}
+			return fmt.Errorf("'%s' failed: %+v", method, err)
+		}
+		if attempt >= c.retries || !transient(err) || ctx.Err() != nil {
+			return fmt.Errorf("'%s' failed after %d attempt(s): %+v", method, attempt+1, err)
+		}
+		backoff := c.backoff << uint(attempt)
+		log.Printf("[*] '%s' failed, retrying in %s (%d/%d): %+v", method, backoff, attempt+1, c.retries, err)
+		// start over with fresh connections in case the daemon restarted
+		c.httpClient.CloseIdleConnections()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// transient returns whether an error is worth retrying.
+func transient(err error) bool {
+	var (
+		statusErr *rpcStatusError
+		resultErr *rpcResultError
+	)
+	if errors.As(err, &resultErr) {
+		return false
+	}
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// outcomeUnknown returns whether Transmission might have acted on a request that errored.
+func outcomeUnknown(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	return transient(err)
+}
+
+// do performs a single RPC call, refreshing the session ID if Transmission asks for it.
+func (c *TransmissionClient) do(ctx context.Context, method string, arguments, result interface{}) error {
+	tag := rand.Int()
+	body, err := json.Marshal(&rpcRequest{Method: method, Arguments: arguments, Tag: tag})
+	if err != nil {
+		return fmt.Errorf("error marshalling request: %+v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var response *http.Response
+	for refreshed := false; ; refreshed = true {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("User-Agent", rpcUserAgent)
+		request.Header.Set(rpcSessionIDHeader, c.getSessionID())
+		request.SetBasicAuth(c.username, c.password)
+		response, err = c.httpClient.Do(request)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusConflict || refreshed {
+			break
+		}
+		// Transmission's CSRF protection hands out a new session ID whenever it restarts
+		response.Body.Close()
+		c.setSessionID(response.Header.Get(rpcSessionIDHeader))
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &rpcStatusError{StatusCode: response.StatusCode}
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %+v", err)
+	}
+	answer := rpcResponse{Arguments: result}
+	err = json.Unmarshal(responseBody, &answer)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling response body as JSON: %+v", err)
+	}
+	if answer.Tag == nil || *answer.Tag != tag {
+		return errors.New("response tag does not match request tag")
+	}
+	if answer.Result != rpcResultSuccess {
+		return &rpcResultError{Result: answer.Result}
+	}
+	return nil
+}
+
+func (c *TransmissionClient) getSessionID() string {
+	c.sessionIDLock.RLock()
+	defer c.sessionIDLock.RUnlock()
+	return c.sessionID
+}
+
+func (c *TransmissionClient) setSessionID(sessionID string) {
+	c.sessionIDLock.Lock()
+	defer c.sessionIDLock.Unlock()
+	c.sessionID = sessionID
+}
+
+type torrentGetArguments struct {
+	Fields []string `json:"fields"`
+	IDs    []int64  `json:"ids,omitempty"`
+}
+
+type torrentGetResult struct {
+	Torrents []*transmissionrpc.Torrent `json:"torrents"`
+}
+
+// TorrentGetAll returns every field of every torrent.
+func (c *TransmissionClient) TorrentGetAll(ctx context.Context) ([]*transmissionrpc.Torrent, error) {
+	return c.TorrentGet(ctx, allTorrentFields, nil)
+}
+
+// TorrentGet returns some fields of some torrents, or of all of them if ids is empty.
+func (c *TransmissionClient) TorrentGet(ctx context.Context, fields []string, ids []int64) ([]*transmissionrpc.Torrent, error) {
+	var result torrentGetResult
+	err := c.call(ctx, rpcMethodTorrentGet, &torrentGetArguments{Fields: fields, IDs: ids}, &result)
+	return result.Torrents, err
+}
+
+type torrentAddResult struct {
+	TorrentAdded     *transmissionrpc.Torrent `json:"torrent-added"`
+	TorrentDuplicate *transmissionrpc.Torrent `json:"torrent-duplicate"`
+}
+
+// TorrentAdd adds a torrent, or returns the existing one if Transmission already has it. The returned torrent only has
+// its ID, Name and HashString set.
+func (c *TransmissionClient) TorrentAdd(ctx context.Context, payload *transmissionrpc.TorrentAddPayload) (*transmissionrpc.Torrent, error) {
+	torrent, _, err := c.torrentAdd(ctx, payload)
+	return torrent, err
+}
+
+// torrentAdd adds a torrent, also returning whether Transmission already had it.
+func (c *TransmissionClient) torrentAdd(
+	ctx context.Context, payload *transmissionrpc.TorrentAddPayload,
+) (torrent *transmissionrpc.Torrent, duplicate bool, err error) {
+	var result torrentAddResult
+	err = c.call(ctx, "torrent-add", payload, &result)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.TorrentAdded != nil {
+		return result.TorrentAdded, false, nil
+	} else if result.TorrentDuplicate != nil {
+		return result.TorrentDuplicate, true, nil
+	}
+	return nil, false, errors.New("'torrent-add' succeeded without returning a torrent")
+}
+
+// TorrentSet changes torrent settings.
+func (c *TransmissionClient) TorrentSet(ctx context.Context, payload *transmissionrpc.TorrentSetPayload) error {
+	return c.call(ctx, "torrent-set", payload, nil)
+}
+
+// TorrentRemove removes torrents, optionally with their data.
+func (c *TransmissionClient) TorrentRemove(ctx context.Context, payload *transmissionrpc.TorrentRemovePayload) error {
+	return c.call(ctx, "torrent-remove", payload, nil)
+}
+
+type torrentSetLocationArguments struct {
+	IDs      []int64 `json:"ids"`
+	Location string  `json:"location"`
+	Move     bool    `json:"move"`
+}
+
+// TorrentSetLocation changes a torrent's download directory, moving its data there if move is set.
+func (c *TransmissionClient) TorrentSetLocation(ctx context.Context, id int64, location string, move bool) error {
+	return c.call(ctx, "torrent-set-location", &torrentSetLocationArguments{
+		IDs:      []int64{id},
+		Location: location,
+		Move:     move,
+	}, nil)
+}
+
+type torrentActionArguments struct {
+	IDs []int64 `json:"ids"`
+}
+
+// TorrentVerify queues torrents to have their data verified.
+func (c *TransmissionClient) TorrentVerify(ctx context.Context, ids []int64) error {
+	return c.call(ctx, "torrent-verify", &torrentActionArguments{IDs: ids}, nil)
+}
+
+// TorrentStart starts torrents.
+func (c *TransmissionClient) TorrentStart(ctx context.Context, ids []int64) error {
+	return c.call(ctx, "torrent-start", &torrentActionArguments{IDs: ids}, nil)
+}
+
+// TorrentStop stops torrents.
+func (c *TransmissionClient) TorrentStop(ctx context.Context, ids []int64) error {
+	return c.call(ctx, "torrent-stop", &torrentActionArguments{IDs: ids}, nil)
+}
@@ -0,0 +1,77 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hekmon/transmissionrpc"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+// fakeTransmission answers RPC calls after failing the first few with failStatus.
+func fakeTransmission(t *testing.T, failures int, failStatus int, arguments string) (*httptest.Server, *int) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != "session" {
+			w.Header().Set("X-Transmission-Session-Id", "session")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		calls++
+		if calls <= failures {
+			w.WriteHeader(failStatus)
+			return
+		}
+		var request struct {
+			Tag int
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %+v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result":    "success",
+			"tag":       request.Tag,
+			"arguments": json.RawMessage(arguments),
+		})
+	}))
+	return server, &calls
+}
+
+func TestTransmissionClientRetriesIdempotentCalls(t *testing.T) {
+	server, calls := fakeTransmission(t, 2, http.StatusBadGateway, `{"torrents": []}`)
+	defer server.Close()
+	client, err := jobs.ConnectToRemote(jobs.TransmissionSettings{Host: server.URL, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.TorrentGetAll(context.Background())
+	if err != nil {
+		t.Errorf("expected torrent-get to succeed after retrying: %+v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 calls, got %d", *calls)
+	}
+}
+
+func TestTransmissionClientReportsAmbiguousAdds(t *testing.T) {
+	server, calls := fakeTransmission(t, 1, http.StatusGatewayTimeout, `{}`)
+	defer server.Close()
+	client, err := jobs.ConnectToRemote(jobs.TransmissionSettings{Host: server.URL, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "magnet:?xt=urn:btih:0000000000000000000000000000000000000000"
+	_, err = client.TorrentAdd(context.Background(), &transmissionrpc.TorrentAddPayload{Filename: &link})
+	var ambiguous *jobs.AmbiguousError
+	if !errors.As(err, &ambiguous) {
+		t.Errorf("expected an ambiguous error, got %+v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected torrent-add not to be retried, got %d calls", *calls)
+	}
+}
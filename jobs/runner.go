@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/antonmedv/expr"
 	"github.com/antonmedv/expr/vm"
@@ -31,48 +35,140 @@ type Runner struct {
 	Config             Config
 	DryRun             bool
 	Verbose            bool
-	client             *transmissionrpc.Client
+	Plan               *Plan // if set, dry runs add the actions they would have taken
 	db                 *bolthold.Store
-	sonarrDropPaths    map[string]bool
-	allTorrents        map[int64]*TransmissionTorrent
+	instances          []*instance
+	imports            *ImportIndex
 	compiledConditions []*vm.Program
 	feedCache          map[string]*gofeed.Feed
+	arrClients         map[string]*arrClient // by source, for notifications
+	lastSyntheticID    int64
+	readOnly           bool // the database is only read from, so that other runs can use it at the same time
 }
 
+// instance is a Transmission instance and its torrents. Jobs run against one instance at a time.
+type instance struct {
+	*Runner
+	name        string
+	client      *TransmissionClient
+	store       stateStore // only usable if the runner has a database
+	allTorrents map[int64]*TransmissionTorrent
+}
+
+// defaultInstanceName is the name of a lone Transmission instance that wasn't given one.
+const defaultInstanceName = "default"
+
 // Run runs the runner's configured jobs
 func (r *Runner) Run(ctx context.Context) (err error) {
-	// pop open the database
-	if r.Config.DatabasePath != "" {
-		r.db, err = bolthold.Open(r.Config.DatabasePath, 0600, nil)
-		if err != nil {
-			return
-		}
-		log.Printf("[*] Using database @ %s", r.Config.DatabasePath)
-		defer r.db.Close()
-	}
-	r.allTorrents = make(map[int64]*TransmissionTorrent)
 	r.feedCache = make(map[string]*gofeed.Feed)
 	// validate jobs before we do any network stuff
+	if err = r.validateInstances(); err != nil {
+		return
+	}
 	if err = r.validateJobs(); err != nil {
 		return
 	}
-	r.client, err = ConnectToRemote(r.Config.Transmission)
-	if err != nil {
+	defer r.close()
+	if err = r.open(); err != nil {
 		return
 	}
-	if r.Config.Sonarr != nil {
-		r.sonarrDropPaths, err = FetchSonarrDrops(*r.Config.Sonarr, 1000)
-		if err != nil {
-			return
-		}
+	if err = r.loadImports(); err != nil {
+		return
 	}
 	if r.DryRun {
 		log.Println("[*] Dry run mode - no changes will be made")
 	}
-	// load it up!
-	err = r.fetchAllTorrents()
+	for _, inst := range r.instances {
+		if err = inst.load(ctx); err != nil {
+			return
+		}
+	}
+	var runErr RunError
+jobs:
+	for _, jobConfig := range r.Config.Jobs {
+		for _, inst := range r.instancesFor(jobConfig) {
+			if len(r.instances) > 1 {
+				log.Printf("[*] Running job: %s on %s", jobConfig.Name, inst.name)
+			} else {
+				log.Printf("[*] Running job: %s", jobConfig.Name)
+			}
+			err = inst.doWithPolicy(ctx, jobConfig)
+			if err != nil {
+				log.Printf("[*] Job '%s' failed: %+v", jobConfig.Name, err)
+				runErr.Errors = append(runErr.Errors, JobError{Job: jobConfig.Name, Instance: inst.name, Err: err})
+				if jobConfig.OnError == OnErrorAbort {
+					break jobs
+				}
+			}
+		}
+	}
+	// whatever happened, keep the state of the jobs that did succeed
+	if r.db != nil {
+		if !r.DryRun {
+			for _, inst := range r.instances {
+				if err = inst.save(); err != nil {
+					return
+				}
+			}
+		}
+		for _, inst := range r.instances {
+			runErr.Errors = append(runErr.Errors, inst.purgeTrash(ctx)...)
+		}
+	}
+	if len(runErr.Errors) > 0 {
+		return &runErr
+	}
+	return nil
+}
+
+// JobError is the error a job failed with.
+type JobError struct {
+	Job      string // empty for failures that aren't any one job's
+	Instance string
+	Err      error
+}
+
+// RunError summarizes every job that failed during a run.
+type RunError struct {
+	Errors []JobError
+}
+
+func (e *RunError) Error() string {
+	lines := []string{fmt.Sprintf("%d job(s) failed:", len(e.Errors))}
+	for _, jobErr := range e.Errors {
+		if jobErr.Job == "" {
+			lines = append(lines, fmt.Sprintf("%+v", jobErr.Err))
+		} else if jobErr.Instance == "" || jobErr.Instance == defaultInstanceName {
+			lines = append(lines, fmt.Sprintf("job '%s': %+v", jobErr.Job, jobErr.Err))
+		} else {
+			lines = append(lines, fmt.Sprintf("job '%s' on '%s': %+v", jobErr.Job, jobErr.Instance, jobErr.Err))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// doWithPolicy runs a job, retrying it if its error policy says so.
+func (r *instance) doWithPolicy(ctx context.Context, job JobConfig) (err error) {
+	for attempt := 0; ; attempt++ {
+		err = r.do(ctx, job)
+		if err == nil || job.OnError != OnErrorRetry || attempt >= job.Retries {
+			return
+		}
+		log.Printf("[*] Job '%s' failed, retrying (%d/%d): %+v", job.Name, attempt+1, job.Retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(job.RetryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// load fetches all torrents and merges in their stored state.
+func (r *instance) load(ctx context.Context) error {
+	r.allTorrents = make(map[int64]*TransmissionTorrent)
+	err := r.fetchAllTorrents(ctx)
 	if err != nil {
-		return fmt.Errorf("could not perform initial fetch of all torrents: %+v", err)
+		return fmt.Errorf("could not perform initial fetch of all torrents on '%s': %+v", r.name, err)
 	}
 	if r.db != nil {
 		err = r.loadTorrentStates()
@@ -80,60 +176,215 @@ func (r *Runner) Run(ctx context.Context) (err error) {
 			return fmt.Errorf("error loading saved torrent states: %+v", err)
 		}
 	}
-	for _, jobConfig := range r.Config.Jobs {
-		log.Printf("[*] Running job: %s", jobConfig.Name)
-		err = r.do(jobConfig)
+	return nil
+}
+
+// save stores the state of all torrents.
+func (r *instance) save() error {
+	for _, torrent := range r.allTorrents {
+		err := r.storeTorrent(torrent)
 		if err != nil {
-			return fmt.Errorf("error running job '%s': %+v", jobConfig.Name, err)
+			return fmt.Errorf("error storing torrent: %+v", err)
 		}
 	}
-	if r.db != nil {
-		// store torrent data
-		for _, torrent := range r.allTorrents {
-			err = r.storeTorrent(torrent)
-			if err != nil {
-				return fmt.Errorf("error storing torrent: %+v", err)
-			}
+	return nil
+}
+
+// open pops open the database and connects to every Transmission instance.
+func (r *Runner) open() (err error) {
+	if r.Config.DatabasePath != "" && r.readOnly {
+		// a database that doesn't exist yet has nothing to read
+		if _, err = os.Stat(r.Config.DatabasePath); err == nil {
+			r.db, err = bolthold.Open(r.Config.DatabasePath, 0600, &bolthold.Options{
+				Options: &bolt.Options{ReadOnly: true, Timeout: time.Second},
+			})
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("error opening database @ %s: %+v", r.Config.DatabasePath, err)
+		}
+	} else if r.Config.DatabasePath != "" {
+		r.db, err = bolthold.Open(r.Config.DatabasePath, 0600, nil)
+		if err != nil {
+			return
+		}
+		log.Printf("[*] Using database @ %s", r.Config.DatabasePath)
+	}
+	for _, settings := range r.Config.Transmission {
+		inst := &instance{Runner: r, name: settings.Name}
+		inst.client, err = ConnectToRemote(settings)
+		if err != nil {
+			return fmt.Errorf("error connecting to Transmission instance '%s': %+v", settings.Name, err)
+		}
+		if r.db != nil {
+			inst.store = newStateStore(r.db, settings.Name)
 		}
+		r.instances = append(r.instances, inst)
 	}
 	return
 }
 
-func (r *Runner) do(job JobConfig) error {
+// validateInstances makes sure every Transmission instance has a unique name. A lone instance doesn't need one.
+func (r *Runner) validateInstances() error {
+	if len(r.Config.Transmission) == 0 {
+		return errors.New("no Transmission instances configured")
+	}
+	names := make(map[string]bool, len(r.Config.Transmission))
+	for i := range r.Config.Transmission {
+		settings := &r.Config.Transmission[i]
+		if settings.Name == "" {
+			if len(r.Config.Transmission) > 1 {
+				return fmt.Errorf("Transmission instance %d needs a name, since there is more than one", i+1)
+			}
+			settings.Name = defaultInstanceName
+		}
+		if names[settings.Name] {
+			return fmt.Errorf("duplicate Transmission instance name '%s'", settings.Name)
+		}
+		names[settings.Name] = true
+	}
+	return nil
+}
+
+// instance returns the connected instance with a name, or nil if there isn't one.
+func (r *Runner) instance(name string) *instance {
+	if name == "" {
+		name = defaultInstanceName
+	}
+	for _, inst := range r.instances {
+		if inst.name == name {
+			return inst
+		}
+	}
+	return nil
+}
+
+// instancesFor returns the instances a job runs on.
+func (r *Runner) instancesFor(job JobConfig) []*instance {
+	if len(job.Instances) == 0 {
+		return r.instances
+	}
+	instances := make([]*instance, 0, len(job.Instances))
+	for _, name := range job.Instances {
+		instances = append(instances, r.instance(name))
+	}
+	return instances
+}
+
+func (r *Runner) close() {
+	if r.db != nil {
+		r.db.Close()
+	}
+}
+
+func (r *instance) do(ctx context.Context, job JobConfig) error {
 	var err error
 	if job.RemoveOptions != nil {
-		err = r.remove(job)
+		err = r.remove(ctx, job)
 	} else if job.TagOptions != nil {
 		err = r.tag(job)
 	} else if job.FeedOptions != nil {
-		err = r.feed(job)
+		err = r.feed(ctx, job)
+	} else if job.MigrateOptions != nil {
+		err = r.migrate(ctx, job)
+	} else if job.SearchOptions != nil {
+		err = r.search(ctx, job)
+	} else if job.WatchOptions != nil {
+		err = r.watch(ctx, job)
 	} else {
 		err = fmt.Errorf("invalid job spec for %s", job.Name)
 	}
 	return err
 }
 
-func (r *Runner) fetchAllTorrents() error {
+func (r *instance) fetchAllTorrents(ctx context.Context) error {
 	if r.Verbose {
 		log.Println("[*] Getting all torrents...")
 	}
-	allTorrents, err := r.client.TorrentGetAll()
+	allTorrents, err := r.client.TorrentGetAll(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting all torrents: %+v", err)
 	}
 	for i := range allTorrents {
-		torrent := ToTransmissionTorrent(*allTorrents[i], r.sonarrDropPaths)
+		torrent := ToTransmissionTorrent(*allTorrents[i], r.imports)
+		torrent.Instance = r.name
 		r.allTorrents[torrent.ID] = &torrent
 	}
 	return nil
 }
 
 func (r *Runner) validateJobs() error {
+	if errs := r.jobErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// JobValidationError is a problem with one of the configured jobs.
+type JobValidationError struct {
+	Index int // in Config.Jobs
+	Name  string
+	Err   error
+}
+
+func (e *JobValidationError) Error() string {
+	return fmt.Sprintf("invalid job '%s': %+v", e.Name, e.Err)
+}
+
+// jobErrors validates every job, returning a *JobValidationError for each invalid one.
+func (r *Runner) jobErrors() (errs []error) {
 	r.compiledConditions = make([]*vm.Program, len(r.Config.Jobs))
-	for i, jobConfig := range r.Config.Jobs {
-		err := r.validateJob(i, jobConfig)
+	for i := range r.Config.Jobs {
+		jobConfig := &r.Config.Jobs[i]
+		err := jobConfig.validateOnError()
+		if err == nil {
+			err = r.validateJobInstances(*jobConfig)
+		}
+		if err == nil {
+			err = r.validateJob(i, *jobConfig)
+		}
 		if err != nil {
-			return fmt.Errorf("invalid job '%s': %+v", jobConfig.Name, err)
+			errs = append(errs, &JobValidationError{Index: i, Name: jobConfig.Name, Err: err})
+		}
+	}
+	return
+}
+
+// Validate checks the config like Run does, without connecting to anything or opening the database, and returns every
+// problem it finds. Problems with jobs are *JobValidationErrors.
+func (r *Runner) Validate() (errs []error) {
+	if err := r.validateInstances(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.Config.Imports.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if webhook := r.Config.Daemon.Webhook; webhook != nil {
+		if err := NewDaemon(r).validateWebhookJobs(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return append(errs, r.jobErrors()...)
+}
+
+// validateJobInstances makes sure a job only targets instances that exist, and that jobs that add torrents only add
+// them to one.
+func (r *Runner) validateJobInstances(job JobConfig) error {
+	adds := job.FeedOptions != nil || job.SearchOptions != nil || job.WatchOptions != nil
+	if adds && len(r.Config.Transmission) > 1 && len(job.Instances) != 1 {
+		return errors.New("jobs that add torrents must pick one of the instances to add them to")
+	}
+	for _, name := range job.Instances {
+		found := false
+		for _, settings := range r.Config.Transmission {
+			if settings.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown Transmission instance '%s'", name)
 		}
 	}
 	return nil
@@ -147,11 +398,37 @@ func (r *Runner) validateJob(index int, job JobConfig) error {
 	}
 	var conditionStr string
 	if job.RemoveOptions != nil {
+		if trash := job.RemoveOptions.Trash; trash != nil {
+			if job.RemoveOptions.DeleteLocal {
+				return errors.New("remove.trash and remove.delete_local are mutually exclusive")
+			}
+			if r.Config.DatabasePath == "" {
+				return errors.New("remove.trash requires a database")
+			}
+			if err := trash.Validate(); err != nil {
+				return err
+			}
+		}
+		if err := r.Config.validateNotify(job.RemoveOptions.Notify); err != nil {
+			return err
+		}
 		conditionStr = job.RemoveOptions.Condition
 	} else if job.TagOptions != nil {
 		conditionStr = job.TagOptions.Condition
+	} else if job.MigrateOptions != nil {
+		if err := r.validateMigrate(job); err != nil {
+			return err
+		}
+		conditionStr = job.MigrateOptions.Condition
 	} else if job.FeedOptions != nil {
 		return job.FeedOptions.Validate()
+	} else if job.SearchOptions != nil {
+		if job.SearchOptions.Interval > 0 && r.Config.DatabasePath == "" {
+			return errors.New("search.interval requires a database")
+		}
+		return job.SearchOptions.Validate()
+	} else if job.WatchOptions != nil {
+		return job.WatchOptions.Validate()
 	}
 	program, err := expr.Compile(conditionStr, torrentExprEnv)
 	if err != nil {
@@ -162,7 +439,7 @@ func (r *Runner) validateJob(index int, job JobConfig) error {
 }
 
 // TODO: refactor and move all of these out of the struct?
-func (r *Runner) remove(job JobConfig) error {
+func (r *instance) remove(ctx context.Context, job JobConfig) error {
 	// validate condition
 	if job.RemoveOptions == nil || job.RemoveOptions.Condition == "" {
 		return errors.New("job has invalid RemoveOptions")
@@ -179,8 +456,19 @@ func (r *Runner) remove(job JobConfig) error {
 			return fmt.Errorf("error evaluting condition '%s':\n:%+v", conditionStr, err)
 		}
 		if output.(bool) {
-			if r.DryRun {
+			if r.DryRun && job.RemoveOptions.Trash != nil {
+				log.Printf("DRY RUN: trash %s", torrent.Name)
+				r.record(job, ActionTrash, torrent, nil)
+				r.planTorrent(job, ActionTrash, torrent)
+				r.notifyArr(job.RemoveOptions.Notify, torrent)
+				// later jobs shouldn't see what this one would have removed
+				delete(r.allTorrents, torrent.ID)
+			} else if r.DryRun {
 				log.Printf("DRY RUN: remove %s", torrent.Name)
+				r.record(job, ActionRemove, torrent, nil)
+				r.planTorrent(job, ActionRemove, torrent)
+				r.notifyArr(job.RemoveOptions.Notify, torrent)
+				delete(r.allTorrents, torrent.ID)
 			} else {
 				if r.Verbose {
 					log.Printf("queueing %s for removal", torrent.Name)
@@ -189,7 +477,15 @@ func (r *Runner) remove(job JobConfig) error {
 			}
 		}
 	}
+	return r.removeTorrents(ctx, job, removeIDs)
+}
+
+// removeTorrents removes (or trashes) torrents matched by a remove job.
+func (r *instance) removeTorrents(ctx context.Context, job JobConfig, removeIDs []int64) error {
 	if len(removeIDs) > 0 {
+		if job.RemoveOptions.Trash != nil {
+			return r.trash(ctx, job, removeIDs)
+		}
 		payload := &transmissionrpc.TorrentRemovePayload{
 			IDs:             removeIDs,
 			DeleteLocalData: job.RemoveOptions.DeleteLocal,
@@ -198,33 +494,51 @@ func (r *Runner) remove(job JobConfig) error {
 		if r.Verbose {
 			log.Printf("[*] removing IDs: %v", removeIDs)
 		}
-		err := r.client.TorrentRemove(payload)
+		err := r.client.TorrentRemove(ctx, payload)
+		for _, id := range removeIDs {
+			r.record(job, ActionRemove, r.allTorrents[id], err)
+		}
 		if err != nil {
 			return err
 		}
 		for _, id := range removeIDs {
-			storedInfo := r.allTorrents[id].StoredTorrentInfo
-			storedInfo.Removed = true
-			if r.db != nil && storedInfo.SafeToPrune() {
-				if r.DryRun {
-					log.Printf("DRY RUN: would prune info")
-				} else if err := r.db.Delete(id, storedInfo); err != nil {
-					return fmt.Errorf("error deleting stored torrent info for ID %d: %+v", id, err)
-				}
-			} else {
-				if r.DryRun {
-					log.Printf("DRY RUN: would not prune info")
-				} else if err = r.db.Update(storedInfo.ID, storedInfo); err != nil {
-					return fmt.Errorf("error saving storted torrent info for ID %d: %+v", id, err)
-				}
+			r.notifyArr(job.RemoveOptions.Notify, r.allTorrents[id])
+			if err = r.forget(id); err != nil {
+				return err
 			}
-			delete(r.allTorrents, id)
 		}
 	}
 	return nil
 }
 
-func (r *Runner) tag(job JobConfig) error {
+// forget drops a torrent that is no longer in Transmission, keeping its stored info only if it's still useful.
+func (r *instance) forget(id int64) error {
+	storedInfo := r.allTorrents[id].StoredTorrentInfo
+	if storedInfo == nil {
+		// nothing was stored without a database
+		delete(r.allTorrents, id)
+		return nil
+	}
+	storedInfo.Removed = true
+	if r.db != nil && storedInfo.SafeToPrune() {
+		if r.DryRun {
+			log.Printf("DRY RUN: would prune info")
+		} else if err := r.store.Delete(id, storedInfo); err != nil && err != bolthold.ErrNotFound {
+			// torrents first seen this run haven't been stored yet
+			return fmt.Errorf("error deleting stored torrent info for ID %d: %+v", id, err)
+		}
+	} else if r.db != nil {
+		if r.DryRun {
+			log.Printf("DRY RUN: would not prune info")
+		} else if err := r.store.Update(storedInfo.ID, storedInfo); err != nil {
+			return fmt.Errorf("error saving storted torrent info for ID %d: %+v", id, err)
+		}
+	}
+	delete(r.allTorrents, id)
+	return nil
+}
+
+func (r *instance) tag(job JobConfig) error {
 	// validate condition
 	if job.TagOptions == nil || job.TagOptions.Condition == "" {
 		return errors.New("job has invalid RemoveOptions")
@@ -234,25 +548,34 @@ func (r *Runner) tag(job JobConfig) error {
 	if err != nil {
 		return fmt.Errorf("error compiling condition '%s':\n%+v", conditionStr, err)
 	}
-	for i, torrent := range r.allTorrents {
+	for _, torrent := range r.allTorrents {
 		output, err := expr.Run(conditionProgram, &torrentConditionInput{*torrent})
 		if err != nil {
 			return fmt.Errorf("error evaluting condition '%s':\n:%+v", conditionStr, err)
 		}
 		if output.(bool) {
-			// tags don't mutate state, so no dry run necessary
-			tagName := job.TagOptions.Name
-			if r.Verbose {
-				log.Printf("[*] Tagging %s with '%s'", torrent.Name, tagName)
-			}
-			stored := r.allTorrents[i].GetOrCreateStored()
-			r.allTorrents[i].Tags = append(stored.Tags, tagName)
+			r.planTorrent(job, ActionTag, torrent)
+			r.tagTorrent(job, torrent)
 		}
 	}
 	return nil
 }
 
-func (r *Runner) feed(job JobConfig) error {
+// tagTorrent applies a tag job's tag to a torrent.
+func (r *instance) tagTorrent(job JobConfig, torrent *TransmissionTorrent) {
+	// tags are only stored at the end of a run, so dry runs can apply them for later jobs to see
+	tagName := job.TagOptions.Name
+	if r.DryRun {
+		log.Printf("DRY RUN: tag %s with '%s'", torrent.Name, tagName)
+	} else if r.Verbose {
+		log.Printf("[*] Tagging %s with '%s'", torrent.Name, tagName)
+	}
+	stored := torrent.GetOrCreateStored()
+	torrent.Tags = append(stored.Tags, tagName)
+	r.record(job, ActionTag, torrent, nil)
+}
+
+func (r *instance) feed(ctx context.Context, job JobConfig) error {
 	if job.FeedOptions.URL == "" {
 		return fmt.Errorf("feed job does not have a URL")
 	}
@@ -268,83 +591,167 @@ func (r *Runner) feed(job JobConfig) error {
 		}
 		r.feedCache[job.FeedOptions.URL] = feed
 	}
+	return r.addFeedItems(ctx, job, feed)
+}
+
+// addFeedItems adds the items in a feed that match the job's feed options and haven't been added already.
+func (r *instance) addFeedItems(ctx context.Context, job JobConfig, feed *gofeed.Feed) error {
+	var err error
 	for _, item := range feed.Items {
 		if item.Link == "" {
 			log.Printf("[*] %s item does not have a Link, skipping", job.FeedOptions.URL)
+			continue
+		}
+		if !feedItemMatches(*item, job.FeedOptions.Match) {
+			continue
 		}
 		// if we enabled storage, check if we already downloaded it
 		if r.db != nil {
-			// item.GUID
 			var stored StoredTorrentInfo
-			err = r.db.FindOne(&stored, bolthold.Where("FeedGUID").Eq(item.GUID).Index("FeedGUID"))
-			if err == bolthold.ErrNotFound {
-				if !feedItemMatches(*item, job.FeedOptions.Match) {
-					continue
-				}
-			} else if err != nil {
-				return fmt.Errorf("error checking if %s is downloaded: %+v", item.GUID, err)
-			} else {
-				// already exists or item does not match
+			err = r.store.FindOne(&stored, bolthold.Where("FeedGUID").Eq(item.GUID).Index("FeedGUID"))
+			if err == nil {
 				continue
+			} else if err != bolthold.ErrNotFound {
+				return fmt.Errorf("error checking if %s is downloaded: %+v", item.GUID, err)
 			}
 		}
 		if r.DryRun {
+			if r.simulatedFeedGUID(item.GUID) {
+				continue
+			}
 			log.Printf("DRY RUN: would add feed item: %s (%s)", item.Title, item.Link)
+			r.planFeedItem(job, item)
+			r.simulateFeedItem(job, item)
 			continue
 		}
-		var downloadDir *string
-		if job.Location != "" {
-			downloadDir = &job.Location
-		}
-		log.Printf("[*] Adding %s", item.Title)
-		torrent, err := r.client.TorrentAdd(
-			&transmissionrpc.TorrentAddPayload{
-				Filename:    &item.Link,
-				DownloadDir: downloadDir,
-			},
-		)
+		err = r.addFeedItem(ctx, job, item)
 		if err != nil {
-			return fmt.Errorf("unable to add torrent from feed item %s: %+v", item.GUID, err)
+			return err
 		}
-		if job.SeedRatio > 0 {
-			err = r.client.TorrentSet(&transmissionrpc.TorrentSetPayload{
-				IDs:            []int64{*torrent.ID},
-				SeedRatioLimit: &job.SeedRatio,
-				SeedRatioMode:  seedRatioModeCustom,
-			})
-			if err != nil {
-				return fmt.Errorf("error setting seed ratio mode for feed item %s: %+v", item.GUID, err)
-			}
+	}
+	return nil
+}
+
+// addFeedItem adds a torrent from a feed item with the job's settings.
+func (r *instance) addFeedItem(ctx context.Context, job JobConfig, item *gofeed.Item) error {
+	log.Printf("[*] Adding %s", item.Title)
+	return r.addTorrent(
+		ctx, job, "feed item "+item.GUID, item.Title, &transmissionrpc.TorrentAddPayload{Filename: &item.Link},
+		item.GUID, job.FeedOptions.Tag,
+	)
+}
+
+// addTorrent adds a torrent with the job's location and seed ratio, and stores its feed GUID and tags, if any. If
+// Transmission already had the torrent, they're added to what's already stored about it. from describes where the
+// torrent came from, for errors.
+func (r *instance) addTorrent(
+	ctx context.Context, job JobConfig, from, name string, payload *transmissionrpc.TorrentAddPayload, feedGUID string,
+	tags ...string,
+) error {
+	if job.Location != "" {
+		payload.DownloadDir = &job.Location
+	}
+	torrent, duplicate, err := r.client.torrentAdd(ctx, payload)
+	if err != nil {
+		r.record(job, ActionAdd, &TransmissionTorrent{Name: name}, err)
+		return fmt.Errorf("unable to add torrent from %s: %+v", from, err)
+	}
+	var (
+		transTorrent = TransmissionTorrent{
+			ID:         *torrent.ID,
+			Name:       *torrent.Name,
+			HashString: *torrent.HashString,
+			Instance:   r.name,
 		}
-		var (
-			transTorrent = TransmissionTorrent{
-				ID:         *torrent.ID,
-				Name:       *torrent.Name,
-				HashString: *torrent.HashString,
+		stored = transTorrent.GetOrCreateStored()
+	)
+	if duplicate {
+		log.Printf("[*] %s was already in Transmission", *torrent.Name)
+		if existing := r.allTorrents[transTorrent.ID]; existing != nil {
+			// keep what the end of the run stores in step
+			stored = existing.GetOrCreateStored()
+		} else if r.db != nil {
+			err = r.store.Get(transTorrent.ID, stored)
+			if err != nil && err != bolthold.ErrNotFound {
+				return fmt.Errorf("error loading stored info for %s: %+v", from, err)
 			}
-			stored = transTorrent.GetOrCreateStored()
-		)
-		stored.FeedGUID = item.GUID
-		if job.FeedOptions.Tag != "" {
-			stored.Tags = append(stored.Tags, job.FeedOptions.Tag)
 		}
-		if r.db != nil {
-			r.db.Upsert(stored.ID, stored)
+	}
+	r.record(job, ActionAdd, &transTorrent, nil)
+	if job.SeedRatio > 0 {
+		err = r.client.TorrentSet(ctx, &transmissionrpc.TorrentSetPayload{
+			IDs:            []int64{*torrent.ID},
+			SeedRatioLimit: &job.SeedRatio,
+			SeedRatioMode:  seedRatioModeCustom,
+		})
+		r.record(job, ActionSet, &transTorrent, err)
+		if err != nil {
+			return fmt.Errorf("error setting seed ratio mode for %s: %+v", from, err)
+		}
+	}
+	if stored.FeedGUID == "" {
+		stored.FeedGUID = feedGUID
+	}
+	stored.addTags(tags...)
+	if r.db != nil {
+		err = r.store.Upsert(stored.ID, stored)
+		if err != nil {
+			return fmt.Errorf("error storing torrent info for %s: %+v", from, err)
 		}
 	}
 	return nil
 }
 
-func (r *Runner) storeTorrent(torrent *TransmissionTorrent) error {
+// simulateFeedItem adds a synthetic torrent for a feed item during a dry run, so that later jobs can see it.
+func (r *instance) simulateFeedItem(job JobConfig, item *gofeed.Item) {
+	r.simulateAdd(job, item.Title, item.GUID, job.FeedOptions.Tag)
+}
+
+// simulateAdd adds a synthetic torrent with the job's settings during a dry run.
+func (r *instance) simulateAdd(job JobConfig, name, feedGUID string, tags ...string) {
+	// real IDs are positive, so count down to avoid colliding with them
+	r.lastSyntheticID--
+	torrent := &TransmissionTorrent{
+		ID:          r.lastSyntheticID,
+		Name:        name,
+		AddedDate:   time.Now(),
+		DownloadDir: job.Location,
+		Status:      transmissionrpc.TorrentStatusDownload,
+		Synthetic:   true,
+		Instance:    r.name,
+		imports:     r.imports,
+	}
+	if job.SeedRatio > 0 {
+		torrent.SeedRatioLimit = job.SeedRatio
+		torrent.SeedRatioMode = *seedRatioModeCustom
+	}
+	stored := torrent.GetOrCreateStored()
+	stored.FeedGUID = feedGUID
+	stored.addTags(tags...)
+	r.allTorrents[torrent.ID] = torrent
+	r.record(job, ActionAdd, torrent, nil)
+}
+
+// simulatedFeedGUID returns whether a dry run has already pretended to add a feed item.
+func (r *instance) simulatedFeedGUID(guid string) bool {
+	for _, torrent := range r.allTorrents {
+		if torrent.Synthetic && torrent.StoredTorrentInfo != nil && torrent.FeedGUID == guid {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *instance) storeTorrent(torrent *TransmissionTorrent) error {
 	if torrent.StoredTorrentInfo == nil {
 		return nil
 	}
-	return r.db.Upsert(torrent.ID, torrent.StoredTorrentInfo)
+	return r.store.Upsert(torrent.ID, torrent.StoredTorrentInfo)
 }
 
-func (r *Runner) loadTorrentStates() error {
+func (r *instance) loadTorrentStates() error {
 	var toRemove []int64
-	err := r.db.ForEach(nil, func(info *StoredTorrentInfo) error {
+	err := r.store.ForEach(nil, func(info *StoredTorrentInfo) error {
 		_, exists := r.allTorrents[info.ID]
 		if exists {
 			r.allTorrents[info.ID].StoredTorrentInfo = info
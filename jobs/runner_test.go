@@ -1,9 +1,23 @@
 package jobs_test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/hekmon/transmissionrpc"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
 
 	"github.com/mmcdole/gofeed"
 )
@@ -54,3 +68,568 @@ func TestParseGazelleFeed(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+// fakeTorrent returns torrent-get JSON for a torrent with every field set, as if it was fetched with all fields.
+func fakeTorrent(id int64, hash, name string) map[string]interface{} {
+	torrent := make(map[string]interface{})
+	torrentType := reflect.TypeOf(transmissionrpc.Torrent{})
+	for i := 0; i < torrentType.NumField(); i++ {
+		field := torrentType.Field(i)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		var zero interface{} = 0 // Transmission sends times as Unix timestamps
+		if fieldType != reflect.TypeOf(time.Time{}) {
+			zero = reflect.Zero(fieldType).Interface()
+		}
+		torrent[field.Tag.Get("json")] = zero
+	}
+	torrent["id"] = id
+	torrent["hashString"] = hash
+	torrent["name"] = name
+	return torrent
+}
+
+// fakeTransmissionWith answers torrent-get with torrents.
+func fakeTransmissionWith(t *testing.T, torrents ...map[string]interface{}) *httptest.Server {
+	arguments, err := json.Marshal(map[string]interface{}{"torrents": torrents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := fakeTransmission(t, 0, 0, string(arguments))
+	return server
+}
+
+func TestRunnerNamespacesInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the same ID on both instances shouldn't share stored state
+	public := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "public torrent"))
+	defer public.Close()
+	private := fakeTransmissionWith(t, fakeTorrent(1, "bbbb", "private torrent"))
+	defer private.Close()
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{
+			{Name: "public", Host: public.URL},
+			{Name: "private", Host: private.URL},
+		},
+		Jobs: []jobs.JobConfig{{
+			Name:       "tag private",
+			TagOptions: &jobs.TagOptions{Name: "private", Condition: `Torrent.Instance == "private"`},
+		}},
+	}
+	runner := jobs.Runner{Config: config}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Jobs = []jobs.JobConfig{{
+		Name:          "remove private",
+		Instances:     []string{"public", "private"},
+		RemoveOptions: &jobs.RemoveOptions{Condition: `"private" in Torrent.Tags`},
+	}}
+	plan := &jobs.Plan{}
+	runner = jobs.Runner{Config: config, DryRun: true, Plan: plan}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	for _, action := range plan.Actions {
+		planned = append(planned, action.Instance+"/"+action.Torrent.Name)
+	}
+	if diff := cmp.Diff(planned, []string{"private/private torrent"}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRunnerPlansMigrations(t *testing.T) {
+	fast := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "long-term seed"))
+	defer fast.Close()
+	seedbox := fakeTransmissionWith(t)
+	defer seedbox.Close()
+	plan := &jobs.Plan{}
+	runner := jobs.Runner{
+		Config: jobs.Config{
+			Transmission: []jobs.TransmissionSettings{
+				{Name: "fast", Host: fast.URL},
+				{Name: "seedbox", Host: seedbox.URL},
+			},
+			Jobs: []jobs.JobConfig{{
+				Name:           "move seeds",
+				MigrateOptions: &jobs.MigrateOptions{To: "seedbox", Condition: "true"},
+			}},
+		},
+		DryRun: true,
+		Plan:   plan,
+	}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	for _, action := range plan.Actions {
+		planned = append(planned, action.Action+" "+action.Instance+"/"+action.Torrent.Name+" -> "+action.To)
+	}
+	if diff := cmp.Diff(planned, []string{"migrate fast/long-term seed -> seedbox"}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRunnerValidateReportsEveryJob(t *testing.T) {
+	runner := jobs.Runner{Config: jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: "http://localhost:9091"}},
+		Jobs: []jobs.JobConfig{
+			{Name: "bad condition", RemoveOptions: &jobs.RemoveOptions{Condition: "Torrent.Name =="}},
+			{Name: "fine", TagOptions: &jobs.TagOptions{Name: "all", Condition: "true"}},
+			{Name: "bad instance", Instances: []string{"nope"}, TagOptions: &jobs.TagOptions{Name: "x", Condition: "true"}},
+		},
+	}}
+	var indexes []int
+	for _, err := range runner.Validate() {
+		jobErr, ok := err.(*jobs.JobValidationError)
+		if !ok {
+			t.Fatalf("expected only job errors, got %+v", err)
+		}
+		indexes = append(indexes, jobErr.Index)
+	}
+	if diff := cmp.Diff([]int{0, 2}, indexes); diff != "" {
+		t.Errorf("unexpected invalid jobs (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunnerValidateAddingJobsPickOneInstance(t *testing.T) {
+	watch := &jobs.WatchOptions{Directory: "/watch"}
+	for _, test := range []struct {
+		transmission []jobs.TransmissionSettings
+		instances    []string
+		valid        bool
+	}{
+		{[]jobs.TransmissionSettings{{Host: "http://localhost:9091"}}, nil, true},
+		{[]jobs.TransmissionSettings{{Name: "a", Host: "http://a:9091"}, {Name: "b", Host: "http://b:9091"}}, nil, false},
+		{[]jobs.TransmissionSettings{{Name: "a", Host: "http://a:9091"}, {Name: "b", Host: "http://b:9091"}}, []string{"a", "b"}, false},
+		{[]jobs.TransmissionSettings{{Name: "a", Host: "http://a:9091"}, {Name: "b", Host: "http://b:9091"}}, []string{"b"}, true},
+	} {
+		runner := jobs.Runner{Config: jobs.Config{
+			Transmission: test.transmission,
+			Jobs:         []jobs.JobConfig{{Name: "watch", Instances: test.instances, WatchOptions: watch}},
+		}}
+		if errs := runner.Validate(); (len(errs) == 0) != test.valid {
+			t.Errorf("%d instance(s), watching on %v: expected validity to be %t, got %v", len(test.transmission), test.instances, test.valid, errs)
+		}
+	}
+}
+
+func TestRunnerSimulatesAddsForLaterJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(path.Join(dir, "new.magnet"), []byte("magnet:?xt=urn:btih:bbbb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "episode"))
+	defer transmission.Close()
+	records := arrImportRecords
+	sonarr := fakeArr(t, "/api/v3/system/status", "/api/v3/history", &records)
+	defer sonarr.Close()
+	plan := &jobs.Plan{}
+	runner := jobs.Runner{
+		Config: jobs.Config{
+			Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+			Sonarr:       &jobs.SonarrSettings{Host: sonarr.URL, APIKey: "deadbeef"},
+			Jobs: []jobs.JobConfig{
+				{Name: "watch", WatchOptions: &jobs.WatchOptions{Directory: dir}},
+				// sees the torrent the watch job would have added
+				{Name: "remove imported", RemoveOptions: &jobs.RemoveOptions{Condition: "Torrent.Imported()"}},
+			},
+		},
+		DryRun: true,
+		Plan:   plan,
+	}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	for _, action := range plan.Actions {
+		if action.File != "" {
+			planned = append(planned, action.Action+" "+path.Base(action.File))
+		} else {
+			planned = append(planned, action.Action+" "+action.Torrent.Name)
+		}
+	}
+	if diff := cmp.Diff([]string{"add new.magnet", "remove episode"}, planned); diff != "" {
+		t.Errorf("unexpected plan (-want +got):\n%s", diff)
+	}
+}
+
+// describePlan describes each planned action as its action, the job that planned it and what it's planned on.
+func describePlan(plan *jobs.Plan) (described []string) {
+	for _, action := range plan.Actions {
+		switch {
+		case action.Torrent != nil:
+			described = append(described, action.Action+" by "+action.Job+": "+action.Torrent.Name)
+		case action.Feed != nil:
+			described = append(described, action.Action+" by "+action.Job+": "+action.Feed.Title)
+		default:
+			described = append(described, action.Action+" by "+action.Job+": "+path.Base(action.File))
+		}
+	}
+	return
+}
+
+func TestRunnerDryRunsShowLaterJobsEarlierChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := fakeTransmissionWith(t, fakeTorrent(1, "aaaa", "a"), fakeTorrent(2, "bbbb", "b"))
+	defer transmission.Close()
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(gazelleFeedTest))
+	}))
+	defer feed.Close()
+	dbPath := path.Join(dir, "db.bbolt")
+	for name, test := range map[string]struct {
+		jobs     []jobs.JobConfig
+		expected []string
+	}{
+		"removed torrents are gone": {
+			[]jobs.JobConfig{
+				{Name: "remove", RemoveOptions: &jobs.RemoveOptions{Condition: `Torrent.Name == "a"`}},
+				{Name: "tag", TagOptions: &jobs.TagOptions{Name: "seen", Condition: "true"}},
+			},
+			[]string{"remove by remove: a", "tag by tag: b"},
+		},
+		"tags are applied": {
+			[]jobs.JobConfig{
+				{Name: "tag", TagOptions: &jobs.TagOptions{Name: "x", Condition: `Torrent.Name == "a"`}},
+				{Name: "remove", RemoveOptions: &jobs.RemoveOptions{Condition: `"x" in Torrent.Tags`}},
+			},
+			[]string{"tag by tag: a", "remove by remove: a"},
+		},
+		"feed items are added": {
+			[]jobs.JobConfig{
+				{Name: "feed", FeedOptions: &jobs.FeedOptions{URL: feed.URL}},
+				// synthetic torrents aren't planned, but are in the history
+				{Name: "tag", TagOptions: &jobs.TagOptions{Name: "new", Condition: "Torrent.Synthetic"}},
+			},
+			[]string{"add by feed: title1", "add by feed: title2"},
+		},
+	} {
+		plan := &jobs.Plan{}
+		config := jobs.Config{
+			DatabasePath: dbPath,
+			Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+			Jobs:         test.jobs,
+		}
+		runner := jobs.Runner{Config: config, DryRun: true, Plan: plan}
+		if err = runner.Run(context.Background()); err != nil {
+			t.Fatalf("%s: %+v", name, err)
+		}
+		if diff := cmp.Diff(test.expected, describePlan(plan)); diff != "" {
+			t.Errorf("%s: unexpected plan (-want +got):\n%s", name, diff)
+		}
+	}
+
+	// dry runs didn't store any tags
+	runner := jobs.Runner{Config: jobs.Config{DatabasePath: dbPath, Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}}}}
+	results, err := runner.Eval(context.Background(), "", `len(Torrent.Tags)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Value != 0 {
+			t.Errorf("expected %s to have no stored tags, got %v", result.Torrent.Name, result.Value)
+		}
+	}
+	entries, err := jobs.History(dbPath, jobs.HistoryQuery{Job: "tag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var synthetic []string
+	for _, entry := range entries {
+		if entry.Action == jobs.ActionTag && (entry.Name == "title1" || entry.Name == "title2") {
+			synthetic = append(synthetic, entry.Name)
+		}
+	}
+	sort.Strings(synthetic)
+	if diff := cmp.Diff([]string{"title1", "title2"}, synthetic); diff != "" {
+		t.Errorf("expected the feed items to be tagged as synthetic torrents (-want +got):\n%s", diff)
+	}
+}
+
+// fakeTransmissionState is a Transmission that keeps track of its torrents as they're added, moved and removed.
+type fakeTransmissionState struct {
+	*httptest.Server
+	torrents []map[string]interface{}
+	calls    []string // every call other than torrent-get, with its interesting arguments
+	// add returns the torrent that torrent-add adds, and whether it's a duplicate. Defaults to a torrent named "added".
+	add  func(arguments fakeRPCArguments) (map[string]interface{}, bool)
+	fail map[string]bool // methods that fail
+}
+
+// fakeRPCArguments are the RPC arguments that fakeTransmissionState looks at.
+type fakeRPCArguments struct {
+	IDs             []int64 `json:"ids"`
+	Location        string  `json:"location"`
+	DownloadDir     string  `json:"download-dir"`
+	Filename        string  `json:"filename"`
+	MetaInfo        string  `json:"metainfo"`
+	Paused          bool    `json:"paused"`
+	DeleteLocalData bool    `json:"delete-local-data"`
+}
+
+func newFakeTransmissionState(t *testing.T, torrents ...map[string]interface{}) *fakeTransmissionState {
+	state := &fakeTransmissionState{torrents: torrents, fail: make(map[string]bool)}
+	state.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != "session" {
+			w.Header().Set("X-Transmission-Session-Id", "session")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var request struct {
+			Method    string
+			Arguments fakeRPCArguments
+			Tag       int
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %+v", err)
+		}
+		result, arguments := "success", state.handle(request.Method, request.Arguments)
+		if state.fail[request.Method] {
+			result = "failed on purpose"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "tag": request.Tag, "arguments": arguments})
+	}))
+	return state
+}
+
+func (s *fakeTransmissionState) handle(method string, arguments fakeRPCArguments) interface{} {
+	call := method
+	// jobs go through torrents in no particular order
+	sort.Slice(arguments.IDs, func(i, j int) bool { return arguments.IDs[i] < arguments.IDs[j] })
+	defer func() {
+		if method != "torrent-get" {
+			s.calls = append(s.calls, call)
+		}
+	}()
+	switch method {
+	case "torrent-get":
+		var torrents []map[string]interface{}
+		for _, torrent := range s.torrents {
+			if len(arguments.IDs) == 0 || containsID(arguments.IDs, torrent["id"].(int64)) {
+				torrents = append(torrents, torrent)
+			}
+		}
+		return map[string]interface{}{"torrents": torrents}
+	case "torrent-add":
+		call = fmt.Sprintf("%s dir=%s paused=%t", method, arguments.DownloadDir, arguments.Paused)
+		torrent, duplicate := fakeTorrent(int64(100+len(s.calls)), "added", "added"), false
+		if s.add != nil {
+			torrent, duplicate = s.add(arguments)
+		}
+		torrent["downloadDir"] = arguments.DownloadDir
+		if duplicate {
+			return map[string]interface{}{"torrent-duplicate": torrent}
+		}
+		s.torrents = append(s.torrents, torrent)
+		return map[string]interface{}{"torrent-added": torrent}
+	case "torrent-set-location":
+		call = fmt.Sprintf("%s %v %s", method, arguments.IDs, arguments.Location)
+		for _, torrent := range s.torrents {
+			if containsID(arguments.IDs, torrent["id"].(int64)) {
+				torrent["downloadDir"] = arguments.Location
+			}
+		}
+	case "torrent-remove":
+		call = fmt.Sprintf("%s %v delete=%t", method, arguments.IDs, arguments.DeleteLocalData)
+		var kept []map[string]interface{}
+		for _, torrent := range s.torrents {
+			if !containsID(arguments.IDs, torrent["id"].(int64)) {
+				kept = append(kept, torrent)
+			}
+		}
+		s.torrents = kept
+	default:
+		call = fmt.Sprintf("%s %v", method, arguments.IDs)
+		if method == "torrent-start" {
+			// magnets get their metadata once they're running
+			for _, torrent := range s.torrents {
+				if containsID(arguments.IDs, torrent["id"].(int64)) {
+					torrent["metadataPercentComplete"] = 1
+				}
+			}
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// planTestConfig removes torrents named "done", and tags them first if tag isn't empty.
+func planTestConfig(dir, transmissionURL, tag string) jobs.Config {
+	config := jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmissionURL}},
+		Jobs: []jobs.JobConfig{{
+			Name:          "remove done",
+			RemoveOptions: &jobs.RemoveOptions{Condition: `Torrent.Name startsWith "done"`},
+		}},
+	}
+	if tag != "" {
+		config.Jobs = append([]jobs.JobConfig{{
+			Name:       "tag done",
+			TagOptions: &jobs.TagOptions{Name: tag, Condition: `Torrent.Name startsWith "done"`},
+		}}, config.Jobs...)
+	}
+	return config
+}
+
+func TestRunnerAppliesPlans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := newFakeTransmissionState(t, fakeTorrent(1, "aaaa", "done"), fakeTorrent(2, "bbbb", "keep"))
+	defer transmission.Close()
+	plan := &jobs.Plan{}
+	runner := jobs.Runner{Config: planTestConfig(dir, transmission.URL, ""), DryRun: true, Plan: plan}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// matches the job's condition, but wasn't planned for
+	transmission.torrents = append(transmission.torrents, fakeTorrent(3, "cccc", "done later"))
+	runner = jobs.Runner{Config: planTestConfig(dir, transmission.URL, "")}
+	if err = runner.Apply(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"torrent-remove [1] delete=false"}, transmission.calls); diff != "" {
+		t.Errorf("unexpected calls (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunnerRefusesDriftedPlans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, test := range map[string]struct {
+		drift    func(dir string, transmission *fakeTransmissionState) error
+		expected string
+	}{
+		"status": {
+			func(dir string, transmission *fakeTransmissionState) error {
+				transmission.torrents[0]["status"] = transmissionrpc.TorrentStatusSeed
+				return nil
+			},
+			"done: status stopped -> seeding",
+		},
+		"download dir": {
+			func(dir string, transmission *fakeTransmissionState) error {
+				transmission.torrents[0]["downloadDir"] = "/elsewhere"
+				return nil
+			},
+			"done: download dir  -> /elsewhere",
+		},
+		"tags": {
+			func(dir string, transmission *fakeTransmissionState) error {
+				// tags are only stored, so another run's tag job is the only way they change
+				config := planTestConfig(dir, transmission.URL, "finished")
+				config.Jobs = config.Jobs[:1]
+				runner := jobs.Runner{Config: config}
+				return runner.Run(context.Background())
+			},
+			"done: tags [] -> [finished]",
+		},
+	} {
+		testDir := path.Join(dir, name)
+		if err = os.Mkdir(testDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		transmission := newFakeTransmissionState(t, fakeTorrent(1, "aaaa", "done"))
+		plan := &jobs.Plan{}
+		runner := jobs.Runner{Config: planTestConfig(testDir, transmission.URL, ""), DryRun: true, Plan: plan}
+		if err = runner.Run(context.Background()); err == nil {
+			err = test.drift(testDir, transmission)
+		}
+		if err != nil {
+			t.Errorf("%s: %+v", name, err)
+			transmission.Close()
+			continue
+		}
+		runner = jobs.Runner{Config: planTestConfig(testDir, transmission.URL, "")}
+		err = runner.Apply(context.Background(), plan)
+		transmission.Close()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected the plan to be refused for %q, got %+v", name, test.expected, err)
+		}
+		if len(transmission.calls) > 0 {
+			t.Errorf("%s: expected nothing to be applied, got %v", name, transmission.calls)
+		}
+	}
+}
+
+func TestRunnerOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(path.Join(dir, "new.magnet"), []byte("magnet:?xt=urn:btih:bbbb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		onError  string
+		expected []string
+	}{
+		{jobs.OnErrorAbort, []string{"torrent-remove [1] delete=false"}},
+		{jobs.OnErrorContinue, []string{"torrent-remove [1] delete=false", "torrent-add dir= paused=false"}},
+		{jobs.OnErrorRetry, []string{
+			"torrent-remove [1] delete=false",
+			"torrent-remove [1] delete=false",
+			"torrent-add dir= paused=false",
+		}},
+	} {
+		transmission := newFakeTransmissionState(t, fakeTorrent(1, "aaaa", "done"))
+		transmission.fail["torrent-remove"] = true
+		runner := jobs.Runner{Config: jobs.Config{
+			Transmission: []jobs.TransmissionSettings{{Host: transmission.URL, Retries: -1}},
+			Jobs: []jobs.JobConfig{
+				{
+					Name:          "remove",
+					OnError:       test.onError,
+					Retries:       1,
+					RetryDelay:    time.Millisecond,
+					RemoveOptions: &jobs.RemoveOptions{Condition: "true"},
+				},
+				{Name: "watch", WatchOptions: &jobs.WatchOptions{Directory: dir}},
+			},
+		}}
+		err = runner.Run(context.Background())
+		transmission.Close()
+		// the watch job moves the file away once it's added
+		os.Rename(path.Join(dir, "done", "new.magnet"), path.Join(dir, "new.magnet"))
+		runErr, ok := err.(*jobs.RunError)
+		if !ok || len(runErr.Errors) != 1 || runErr.Errors[0].Job != "remove" {
+			t.Errorf("%s: expected only the remove job to fail, got %+v", test.onError, err)
+		}
+		if diff := cmp.Diff(test.expected, transmission.calls); diff != "" {
+			t.Errorf("%s: unexpected calls (-want +got):\n%s", test.onError, diff)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/timshannon/bolthold"
+)
+
+const searchTimeout = time.Minute
+
+// SearchState records when a search job last searched for an instance.
+type SearchState struct {
+	Job        string `boltholdKey:"Job"`
+	SearchedAt time.Time
+}
+
+// torznabError is how Torznab endpoints report errors, often with a 200 status.
+type torznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        string   `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+// searchURL returns the Torznab URL for a query. The API key is left out so that the URL can go in plans and logs.
+func (s SearchOptions) searchURL(query string) string {
+	endpoint, _ := url.Parse(s.URL) // already validated
+	values := endpoint.Query()
+	values.Set("t", "search")
+	values.Set("q", query)
+	if len(s.Categories) > 0 {
+		categories := make([]string, len(s.Categories))
+		for i, category := range s.Categories {
+			categories[i] = strconv.Itoa(category)
+		}
+		values.Set("cat", strings.Join(categories, ","))
+	}
+	if s.Limit > 0 {
+		values.Set("limit", strconv.Itoa(s.Limit))
+	}
+	endpoint.RawQuery = values.Encode()
+	return endpoint.String()
+}
+
+// fetch runs a search and parses the results, which Torznab returns as an RSS feed.
+func (s SearchOptions) fetch(ctx context.Context, searchURL string) (*gofeed.Feed, error) {
+	endpoint, _ := url.Parse(searchURL)
+	if s.APIKey != "" {
+		values := endpoint.Query()
+		values.Set("apikey", s.APIKey)
+		endpoint.RawQuery = values.Encode()
+	}
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+	httpClient, err := s.Transport.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error setting up transport: %+v", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		// don't leak the API key in the URL
+		return nil, fmt.Errorf("error searching %s: %+v", searchURL, unwrapURLError(err))
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading search results: %+v", err)
+	}
+	var torznabErr torznabError
+	if xml.Unmarshal(body, &torznabErr) == nil {
+		return nil, fmt.Errorf("error searching %s: %s (code %s)", searchURL, torznabErr.Description, torznabErr.Code)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d code searching %s", response.StatusCode, searchURL)
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing search results: %+v", err)
+	}
+	return feed, nil
+}
+
+// unwrapURLError drops the URL from an HTTP client error.
+func unwrapURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+// search runs a search job's queries and adds the results like feed items, so that releases from before a feed's
+// window can be backfilled.
+func (r *instance) search(ctx context.Context, job JobConfig) error {
+	options := job.SearchOptions
+	if options.Interval > 0 {
+		var state SearchState
+		err := r.store.Get(job.Name, &state)
+		if err != nil && err != bolthold.ErrNotFound {
+			return fmt.Errorf("error loading search state: %+v", err)
+		}
+		if next := state.SearchedAt.Add(options.Interval); time.Now().Before(next) {
+			if r.Verbose {
+				log.Printf("[*] Not searching again until %s", next.Format(time.RFC3339))
+			}
+			return nil
+		}
+	}
+	queries := options.Queries
+	if len(queries) == 0 {
+		queries = []string{""}
+	}
+	for _, query := range queries {
+		searchURL := options.searchURL(query)
+		feed, exists := r.feedCache[searchURL]
+		if !exists {
+			var err error
+			if feed, err = options.fetch(ctx, searchURL); err != nil {
+				return err
+			}
+			r.feedCache[searchURL] = feed
+		}
+		if r.Verbose {
+			log.Printf("[*] '%s' found %d result(s)", query, len(feed.Items))
+		}
+		// results go through the feed pipeline, which plans and applies them by URL
+		feedJob := job
+		feedJob.FeedOptions = &FeedOptions{URL: searchURL, Tag: options.Tag, Match: options.Match}
+		if err := r.addFeedItems(ctx, feedJob, feed); err != nil {
+			return err
+		}
+	}
+	if options.Interval > 0 && !r.DryRun {
+		err := r.store.Upsert(job.Name, &SearchState{Job: job.Name, SearchedAt: time.Now()})
+		if err != nil {
+			return fmt.Errorf("error saving search state: %+v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+const torznabResults = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+	<item>
+		<title>Show S01E01 1080p</title>
+		<guid>https://indexer.example/details/1</guid>
+		<link>https://indexer.example/download/1.torrent</link>
+		<torznab:attr name="seeders" value="10"/>
+	</item>
+	<item>
+		<title>Show S01E01 480p</title>
+		<guid>https://indexer.example/details/2</guid>
+		<link>https://indexer.example/download/2.torrent</link>
+	</item>
+</channel>
+</rss>`
+
+func TestRunnerSearches(t *testing.T) {
+	transmission := fakeTransmissionWith(t)
+	defer transmission.Close()
+	torznab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("apikey") != "deadbeef" {
+			w.Write([]byte(`<error code="100" description="Invalid API Key"/>`))
+			return
+		}
+		if query.Get("t") != "search" || query.Get("q") != "show" || query.Get("cat") != "5000,5040" {
+			t.Errorf("unexpected search: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(torznabResults))
+	}))
+	defer torznab.Close()
+	search := &jobs.SearchOptions{
+		URL:        torznab.URL,
+		APIKey:     "deadbeef",
+		Queries:    []string{"show"},
+		Categories: []int{5000, 5040},
+		Match:      &jobs.FeedMatchOptions{Field: "title", RegExp: "1080p"},
+	}
+	plan := &jobs.Plan{}
+	runner := jobs.Runner{
+		Config: jobs.Config{
+			Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+			Jobs:         []jobs.JobConfig{{Name: "backfill", SearchOptions: search}},
+		},
+		DryRun: true,
+		Plan:   plan,
+	}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 {
+		t.Fatalf("expected 1 planned add, got %d", len(plan.Actions))
+	}
+	feed := plan.Actions[0].Feed
+	if feed.Link != "https://indexer.example/download/1.torrent" {
+		t.Errorf("expected the 1080p release to be added, got %s", feed.Link)
+	}
+	if strings.Contains(feed.URL, "deadbeef") {
+		t.Errorf("API key leaked into the plan: %s", feed.URL)
+	}
+
+	search.APIKey = "wrong"
+	runner = jobs.Runner{Config: runner.Config, DryRun: true}
+	err := runner.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Invalid API Key") {
+		t.Errorf("expected the Torznab error to be reported, got %+v", err)
+	}
+}
+
+// writeServerCA writes the certificate of an httptest TLS server to a PEM file, to use as a ca_file.
+func writeServerCA(t *testing.T, dir string, server *httptest.Server) string {
+	caFile := path.Join(dir, "ca.pem")
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, encoded, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return caFile
+}
+
+func TestRunnerSearchesWithTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	transmission := fakeTransmissionWith(t)
+	defer transmission.Close()
+	torznab := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(torznabResults))
+	}))
+	defer torznab.Close()
+	search := &jobs.SearchOptions{URL: torznab.URL}
+	config := jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Jobs:         []jobs.JobConfig{{Name: "backfill", SearchOptions: search}},
+	}
+	runner := jobs.Runner{Config: config, DryRun: true}
+	if err = runner.Run(context.Background()); err == nil {
+		t.Error("expected an unknown CA to be rejected")
+	}
+
+	search.Transport.CAFile = writeServerCA(t, dir, torznab)
+	plan := &jobs.Plan{}
+	runner = jobs.Runner{Config: config, DryRun: true, Plan: plan}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 2 {
+		t.Errorf("expected 2 planned adds, got %d", len(plan.Actions))
+	}
+}
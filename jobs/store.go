@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const instanceBucketPrefix = "instance:"
+
+// stateStore namespaces per-torrent state by Transmission instance, since torrent IDs and even info hashes are only
+// unique within one daemon. The default instance keeps using bolthold's top-level buckets, so that databases from
+// before multiple instances were supported keep working.
+type stateStore struct {
+	db     *bolthold.Store
+	bucket []byte // nil for the default instance
+}
+
+func newStateStore(db *bolthold.Store, instance string) stateStore {
+	store := stateStore{db: db}
+	if instance != defaultInstanceName {
+		store.bucket = []byte(instanceBucketPrefix + instance)
+	}
+	return store
+}
+
+// update runs fn with the instance's bucket, creating it if needed.
+func (s stateStore) update(fn func(parent *bolt.Bucket) error) error {
+	return s.db.Bolt().Update(func(tx *bolt.Tx) error {
+		parent, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return err
+		}
+		return fn(parent)
+	})
+}
+
+// view runs fn with the instance's bucket, or not at all if nothing has been stored for the instance yet.
+func (s stateStore) view(fn func(parent *bolt.Bucket) error) (exists bool, err error) {
+	err = s.db.Bolt().View(func(tx *bolt.Tx) error {
+		parent := tx.Bucket(s.bucket)
+		if parent == nil {
+			return nil
+		}
+		exists = true
+		return fn(parent)
+	})
+	return
+}
+
+func (s stateStore) Upsert(key, data interface{}) error {
+	if s.bucket == nil {
+		return s.db.Upsert(key, data)
+	}
+	return s.update(func(parent *bolt.Bucket) error {
+		return s.db.UpsertBucket(parent, key, data)
+	})
+}
+
+func (s stateStore) Update(key, data interface{}) error {
+	if s.bucket == nil {
+		return s.db.Update(key, data)
+	}
+	return s.update(func(parent *bolt.Bucket) error {
+		return s.db.UpdateBucket(parent, key, data)
+	})
+}
+
+func (s stateStore) Delete(key, dataType interface{}) error {
+	if s.bucket == nil {
+		return s.db.Delete(key, dataType)
+	}
+	return s.update(func(parent *bolt.Bucket) error {
+		return s.db.DeleteFromBucket(parent, key, dataType)
+	})
+}
+
+func (s stateStore) Get(key, result interface{}) error {
+	if s.bucket == nil {
+		return s.db.Get(key, result)
+	}
+	exists, err := s.view(func(parent *bolt.Bucket) error {
+		return s.db.GetFromBucket(parent, key, result)
+	})
+	if err == nil && !exists {
+		return bolthold.ErrNotFound
+	}
+	return err
+}
+
+func (s stateStore) Find(result interface{}, query *bolthold.Query) error {
+	if s.bucket == nil {
+		return s.db.Find(result, query)
+	}
+	_, err := s.view(func(parent *bolt.Bucket) error {
+		return s.db.FindInBucket(parent, result, query)
+	})
+	return err
+}
+
+func (s stateStore) FindOne(result interface{}, query *bolthold.Query) error {
+	if s.bucket == nil {
+		return s.db.FindOne(result, query)
+	}
+	exists, err := s.view(func(parent *bolt.Bucket) error {
+		return s.db.FindOneInBucket(parent, result, query)
+	})
+	if err == nil && !exists {
+		return bolthold.ErrNotFound
+	}
+	return err
+}
+
+func (s stateStore) ForEach(query *bolthold.Query, fn interface{}) error {
+	if s.bucket == nil {
+		return s.db.ForEach(query, fn)
+	}
+	_, err := s.view(func(parent *bolt.Bucket) error {
+		return s.db.ForEachInBucket(parent, query, fn)
+	})
+	return err
+}
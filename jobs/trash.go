@@ -0,0 +1,392 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hekmon/transmissionrpc"
+	"github.com/timshannon/bolthold"
+)
+
+const (
+	trashMoveTimeout = 30 * time.Minute
+)
+
+// TrashedTorrent records where a quarantined torrent came from, so that it can be restored or purged later.
+type TrashedTorrent struct {
+	HashString  string `boltholdKey:"HashString"`
+	Name        string
+	MagnetLink  string
+	MetaInfo    string // base64-encoded .torrent file, if it was readable when trashed
+	DownloadDir string // where the data lived before it was trashed
+	Location    string // quarantine directory currently holding the data
+	Job         string
+	Tags        []string
+	TrashedAt   time.Time
+	ExpiresAt   time.Time `boltholdIndex:"ExpiresAt"`
+}
+
+// torrent returns enough of a TransmissionTorrent to identify the trashed torrent.
+func (t TrashedTorrent) torrent() *TransmissionTorrent {
+	return &TransmissionTorrent{Name: t.Name, HashString: t.HashString}
+}
+
+// trash moves torrent data into a quarantine directory, removes the torrents from Transmission and records their
+// provenance. Torrents are trashed one at a time, so that a failure never leaves a torrent in Transmission running out
+// of the trash, where purging would delete its data.
+func (r *instance) trash(ctx context.Context, job JobConfig, ids []int64) error {
+	options := job.RemoveOptions.Trash
+	now := time.Now()
+	for _, id := range ids {
+		torrent := r.allTorrents[id]
+		location := path.Join(options.Location, torrent.HashString)
+		log.Printf("[+] Trashing %s to %s", torrent.Name, location)
+		// Transmission deletes its copy of the .torrent file along with the torrent
+		metaInfo := r.readMetaInfo(torrent)
+		err := r.client.TorrentSetLocation(ctx, id, location, true)
+		if err == nil {
+			err = r.waitForLocation(ctx, id, location)
+		}
+		if err == nil {
+			err = r.client.TorrentRemove(ctx, &transmissionrpc.TorrentRemovePayload{IDs: []int64{id}})
+		}
+		r.record(job, ActionTrash, torrent, err)
+		if err != nil {
+			r.untrash(ctx, torrent)
+			return fmt.Errorf("error moving %s to trash: %+v", torrent.Name, err)
+		}
+		r.record(job, ActionRemove, torrent, nil)
+		trashed := &TrashedTorrent{
+			HashString:  torrent.HashString,
+			Name:        torrent.Name,
+			MagnetLink:  torrent.MagnetLink,
+			DownloadDir: torrent.DownloadDir,
+			Location:    location,
+			Job:         job.Name,
+			TrashedAt:   now,
+			ExpiresAt:   now.Add(options.Retention),
+		}
+		if torrent.StoredTorrentInfo != nil {
+			trashed.Tags = torrent.Tags
+		}
+		trashed.MetaInfo = metaInfo
+		err = r.store.Upsert(trashed.HashString, trashed)
+		if err != nil {
+			return fmt.Errorf("%s was trashed to %s, but its trash info could not be saved: %+v", torrent.Name, location, err)
+		}
+		r.notifyArr(job.RemoveOptions.Notify, torrent)
+		if err = r.forget(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untrash moves a torrent that couldn't be trashed back to where it was, if it got moved at all.
+func (r *instance) untrash(ctx context.Context, torrent *TransmissionTorrent) {
+	err := r.client.TorrentSetLocation(ctx, torrent.ID, torrent.DownloadDir, true)
+	if err == nil {
+		err = r.waitForLocation(ctx, torrent.ID, torrent.DownloadDir)
+	}
+	if err != nil {
+		log.Printf("[*] could not move %s back to %s: %+v", torrent.Name, torrent.DownloadDir, err)
+	}
+}
+
+// readMetaInfo returns a torrent's base64-encoded .torrent file, or "" if it isn't readable. TorrentFile is a path on
+// the Transmission host, which is only readable if we happen to share a filesystem, so whatever is there is only used
+// if it's actually this torrent's.
+func (r *instance) readMetaInfo(torrent *TransmissionTorrent) string {
+	if torrent.TorrentFile == "" {
+		return ""
+	}
+	metaInfo, err := ioutil.ReadFile(torrent.TorrentFile)
+	if err == nil {
+		var hash string
+		hash, err = infoHash(metaInfo)
+		if err == nil && !strings.EqualFold(hash, torrent.HashString) {
+			err = fmt.Errorf("it's for %s", hash)
+		}
+	}
+	if err != nil {
+		if r.Verbose {
+			log.Printf("[*] could not read %s, falling back to the magnet link: %+v", torrent.TorrentFile, err)
+		}
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(metaInfo)
+}
+
+// infoHash returns the hex-encoded info hash of a .torrent file, which is the SHA-1 of its bencoded info dictionary.
+func infoHash(metaInfo []byte) (string, error) {
+	if len(metaInfo) == 0 || metaInfo[0] != 'd' {
+		return "", errors.New("not a .torrent file")
+	}
+	for i := 1; i < len(metaInfo) && metaInfo[i] != 'e'; {
+		keyEnd, err := bencodeEnd(metaInfo, i)
+		if err != nil {
+			return "", err
+		}
+		valueEnd, err := bencodeEnd(metaInfo, keyEnd)
+		if err != nil {
+			return "", err
+		}
+		if string(metaInfo[i:keyEnd]) == "4:info" {
+			sum := sha1.Sum(metaInfo[keyEnd:valueEnd])
+			return hex.EncodeToString(sum[:]), nil
+		}
+		i = valueEnd
+	}
+	return "", errors.New("no info dictionary in .torrent file")
+}
+
+// bencodeEnd returns where the bencoded value starting at start ends.
+func bencodeEnd(data []byte, start int) (int, error) {
+	if start >= len(data) {
+		return 0, errors.New("truncated .torrent file")
+	}
+	switch c := data[start]; {
+	case c == 'i':
+		end := bytes.IndexByte(data[start:], 'e')
+		if end < 0 {
+			return 0, errors.New("truncated .torrent file")
+		}
+		return start + end + 1, nil
+	case c == 'l' || c == 'd':
+		i := start + 1
+		for i < len(data) && data[i] != 'e' {
+			var err error
+			if i, err = bencodeEnd(data, i); err != nil {
+				return 0, err
+			}
+		}
+		if i >= len(data) {
+			return 0, errors.New("truncated .torrent file")
+		}
+		return i + 1, nil
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(data[start:], ':')
+		if colon < 0 {
+			return 0, errors.New("truncated .torrent file")
+		}
+		length, err := strconv.Atoi(string(data[start : start+colon]))
+		if err != nil {
+			return 0, fmt.Errorf("bad string length in .torrent file: %+v", err)
+		}
+		end := start + colon + 1 + length
+		if end > len(data) {
+			return 0, errors.New("truncated .torrent file")
+		}
+		return end, nil
+	}
+	return 0, fmt.Errorf("unexpected %q in .torrent file", data[start])
+}
+
+// waitForLocation blocks until Transmission reports that a torrent has finished moving to location.
+func (r *instance) waitForLocation(ctx context.Context, id int64, location string) error {
+	ctx, cancel := context.WithTimeout(ctx, trashMoveTimeout)
+	defer cancel()
+	ticker := time.NewTicker(r.client.pollInterval)
+	defer ticker.Stop()
+	for {
+		torrents, err := r.client.TorrentGet(ctx, []string{"downloadDir", "error", "errorString"}, []int64{id})
+		if err != nil {
+			return fmt.Errorf("error checking location of torrent ID %d: %+v", id, err)
+		}
+		if len(torrents) != 1 {
+			return fmt.Errorf("torrent ID %d disappeared while moving", id)
+		}
+		torrent := torrents[0]
+		if torrent.Error != nil && *torrent.Error != 0 {
+			return fmt.Errorf("error moving torrent ID %d: %s", id, *torrent.ErrorString)
+		}
+		if torrent.DownloadDir != nil && path.Clean(*torrent.DownloadDir) == path.Clean(location) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for torrent ID %d to move to %s: %+v", id, location, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes quarantined data that has outlived its retention period, returning the trash that couldn't be
+// purged by the job that trashed it. Trash that can't be purged is kept, so that purging it is tried again next time.
+// Trash that only a person can purge is logged every run instead of failing it.
+func (r *instance) purgeTrash(ctx context.Context) (failures []JobError) {
+	var expired []TrashedTorrent
+	err := r.store.Find(&expired, bolthold.Where("ExpiresAt").Lt(time.Now()).Index("ExpiresAt"))
+	if err != nil {
+		return []JobError{{Instance: r.name, Err: fmt.Errorf("error finding expired trash: %+v", err)}}
+	}
+	for _, trashed := range expired {
+		if r.DryRun {
+			log.Printf("DRY RUN: purge %s from %s", trashed.Name, trashed.Location)
+			r.record(JobConfig{Name: trashed.Job}, ActionPurge, trashed.torrent(), nil)
+			continue
+		}
+		if trashed.MetaInfo == "" {
+			if _, err = os.Stat(trashed.Location); err != nil {
+				log.Printf("[*] can't purge %s without its .torrent file, delete %s on the Transmission host by hand",
+					trashed.Name, trashed.Location)
+				continue
+			}
+		}
+		log.Printf("[+] Purging %s from %s", trashed.Name, trashed.Location)
+		err = r.purge(ctx, trashed)
+		if err == nil {
+			err = r.store.Delete(trashed.HashString, trashed)
+			if err != nil {
+				err = fmt.Errorf("error deleting trash info: %+v", err)
+			}
+		}
+		r.record(JobConfig{Name: trashed.Job}, ActionPurge, trashed.torrent(), err)
+		if err != nil {
+			log.Printf("error purging %s: %+v", trashed.Name, err)
+			failures = append(failures, JobError{
+				Job:      trashed.Job,
+				Instance: r.name,
+				Err:      fmt.Errorf("error purging %s: %+v", trashed.Name, err),
+			})
+		}
+	}
+	return failures
+}
+
+// purge deletes a trashed torrent's data. The data is on the Transmission host, which may not be this one, so
+// Transmission deletes it by re-adding the torrent and removing it with its data. That needs the .torrent file, so
+// without one the data can only be deleted if it's here too.
+func (r *instance) purge(ctx context.Context, trashed TrashedTorrent) error {
+	if trashed.MetaInfo != "" {
+		paused := true
+		torrent, duplicate, err := r.client.torrentAdd(ctx, &transmissionrpc.TorrentAddPayload{
+			MetaInfo:    &trashed.MetaInfo,
+			DownloadDir: &trashed.Location,
+			Paused:      &paused,
+		})
+		if err != nil {
+			return fmt.Errorf("error re-adding torrent to delete its data: %+v", err)
+		}
+		// the torrent is back in Transmission, which is using the data, so it can't be deleted by any means
+		if duplicate {
+			return fmt.Errorf("%s is in Transmission again, so its data in %s is kept", trashed.Name, trashed.Location)
+		}
+		return r.client.TorrentRemove(ctx, &transmissionrpc.TorrentRemovePayload{
+			IDs:             []int64{*torrent.ID},
+			DeleteLocalData: true,
+		})
+	}
+	if _, err := os.Stat(trashed.Location); err != nil {
+		return fmt.Errorf("can't delete %s, which may only exist on the Transmission host: %+v", trashed.Location, err)
+	}
+	return os.RemoveAll(trashed.Location)
+}
+
+// Restore re-adds trashed torrents by info hash and moves their data back to where it came from. If instanceName is
+// empty, each torrent is restored to whichever Transmission instance it was trashed from.
+func (r *Runner) Restore(ctx context.Context, instanceName string, hashes []string) (err error) {
+	if r.Config.DatabasePath == "" {
+		return fmt.Errorf("restoring requires a database")
+	}
+	if err = r.validateInstances(); err != nil {
+		return
+	}
+	defer r.close()
+	if err = r.open(); err != nil {
+		return
+	}
+	candidates := r.instances
+	if instanceName != "" {
+		inst := r.instance(instanceName)
+		if inst == nil {
+			return fmt.Errorf("unknown Transmission instance '%s'", instanceName)
+		}
+		candidates = []*instance{inst}
+	}
+	for _, hash := range hashes {
+		var trashedFrom []*instance
+		for _, inst := range candidates {
+			err = inst.store.Get(hash, &TrashedTorrent{})
+			if err == nil {
+				trashedFrom = append(trashedFrom, inst)
+			} else if err != bolthold.ErrNotFound {
+				return fmt.Errorf("error looking up %s: %+v", hash, err)
+			}
+		}
+		switch len(trashedFrom) {
+		case 0:
+			return fmt.Errorf("no trashed torrent with hash %s", hash)
+		case 1:
+		default:
+			return fmt.Errorf("%s was trashed from more than one instance, pick one to restore it to", hash)
+		}
+		err = trashedFrom[0].restore(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("error restoring %s: %+v", hash, err)
+		}
+	}
+	return nil
+}
+
+func (r *instance) restore(ctx context.Context, hash string) error {
+	var trashed TrashedTorrent
+	err := r.store.Get(hash, &trashed)
+	if err == bolthold.ErrNotFound {
+		return fmt.Errorf("no trashed torrent with hash %s", hash)
+	} else if err != nil {
+		return err
+	}
+	if r.DryRun {
+		log.Printf("DRY RUN: restore %s to %s", trashed.Name, trashed.DownloadDir)
+		r.record(JobConfig{Name: trashed.Job}, ActionRestore, trashed.torrent(), nil)
+		return nil
+	}
+	payload := &transmissionrpc.TorrentAddPayload{DownloadDir: &trashed.Location}
+	if trashed.MetaInfo != "" {
+		payload.MetaInfo = &trashed.MetaInfo
+	} else {
+		payload.Filename = &trashed.MagnetLink
+	}
+	log.Printf("[+] Restoring %s", trashed.Name)
+	torrent, err := r.client.TorrentAdd(ctx, payload)
+	r.record(JobConfig{Name: trashed.Job}, ActionRestore, trashed.torrent(), err)
+	if err != nil {
+		return err
+	}
+	if trashed.MetaInfo != "" {
+		// Transmission can't move files it doesn't have metadata for, so magnets stay in quarantine
+		err = r.client.TorrentSetLocation(ctx, *torrent.ID, trashed.DownloadDir, true)
+		if err != nil {
+			return fmt.Errorf("error moving data back to %s: %+v", trashed.DownloadDir, err)
+		}
+		err = r.waitForLocation(ctx, *torrent.ID, trashed.DownloadDir)
+		if err != nil {
+			return err
+		}
+		err = r.client.TorrentVerify(ctx, []int64{*torrent.ID})
+		if err != nil {
+			return fmt.Errorf("error verifying restored data: %+v", err)
+		}
+	} else {
+		log.Printf("[*] %s was restored from a magnet link, so its data remains in %s", trashed.Name, trashed.Location)
+	}
+	stored := &StoredTorrentInfo{ID: *torrent.ID, Tags: trashed.Tags}
+	err = r.store.Upsert(stored.ID, stored)
+	if err != nil {
+		return fmt.Errorf("error saving torrent info: %+v", err)
+	}
+	return r.store.Delete(trashed.HashString, trashed)
+}
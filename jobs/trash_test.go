@@ -0,0 +1,231 @@
+package jobs_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+const trashTestInfo = "d6:lengthi1e4:name1:ae"
+
+// trashTestTorrents returns a torrent whose .torrent file is readable, and one that only has a magnet link since the
+// file at its .torrent path is some other torrent's.
+func trashTestTorrents(t *testing.T, dir string) (withFile, magnet map[string]interface{}) {
+	torrentFile := path.Join(dir, "a.torrent")
+	if err := ioutil.WriteFile(torrentFile, []byte("d8:announce0:4:info"+trashTestInfo+"e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(trashTestInfo))
+	withFile = fakeTorrent(1, hex.EncodeToString(sum[:]), "with file")
+	withFile["torrentFile"] = torrentFile
+	withFile["downloadDir"] = "/downloads"
+	magnet = fakeTorrent(2, "bbbb", "magnet")
+	magnet["magnetLink"] = "magnet:?xt=urn:btih:bbbb"
+	magnet["torrentFile"] = torrentFile
+	magnet["downloadDir"] = "/downloads"
+	return
+}
+
+func trashTestConfig(dir, transmissionURL string, retention time.Duration) jobs.Config {
+	return jobs.Config{
+		DatabasePath: path.Join(dir, "db.bbolt"),
+		Transmission: []jobs.TransmissionSettings{{Host: transmissionURL}},
+		Jobs: []jobs.JobConfig{{
+			Name: "trash",
+			RemoveOptions: &jobs.RemoveOptions{
+				Condition: "true",
+				Trash:     &jobs.TrashOptions{Location: path.Join(dir, "trash"), Retention: retention},
+			},
+		}},
+	}
+}
+
+func TestRunnerTrashesAndRestores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, _ := trashTestTorrents(t, dir)
+	hash := withFile["hashString"].(string)
+	location := path.Join(dir, "trash", hash)
+	transmission := newFakeTransmissionState(t, withFile)
+	defer transmission.Close()
+	runner := jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Hour)}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	runner = jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Hour)}
+	if err = runner.Restore(context.Background(), "", []string{hash}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"torrent-set-location [1] " + location,
+		"torrent-remove [1] delete=false",
+		"torrent-add dir=" + location + " paused=false",
+		"torrent-set-location [102] /downloads",
+		"torrent-verify [102]",
+	}
+	if diff := cmp.Diff(expected, transmission.calls); diff != "" {
+		t.Errorf("unexpected calls (-want +got):\n%s", diff)
+	}
+	runner = jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Hour)}
+	if err = runner.Restore(context.Background(), "", []string{hash}); err == nil {
+		t.Error("expected a restored torrent to no longer be in the trash")
+	}
+}
+
+func TestRunnerPurgesExpiredTrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, magnet := trashTestTorrents(t, dir)
+	location := path.Join(dir, "trash", withFile["hashString"].(string))
+	transmission := newFakeTransmissionState(t, withFile, magnet)
+	defer transmission.Close()
+	runner := jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Nanosecond)}
+	// the magnet's data isn't here to delete, since the fake Transmission doesn't move anything, which only a person
+	// can do something about
+	if err = runner.Run(context.Background()); err != nil {
+		t.Errorf("expected trash that can only be purged by hand not to fail the run: %+v", err)
+	}
+	// both torrents are trashed in no particular order
+	if len(transmission.calls) >= 4 {
+		sort.Strings(transmission.calls[:4])
+	}
+	expected := []string{
+		"torrent-remove [1] delete=false",
+		"torrent-remove [2] delete=false",
+		"torrent-set-location [1] " + location,
+		"torrent-set-location [2] " + path.Join(dir, "trash", "bbbb"),
+		"torrent-add dir=" + location + " paused=true",
+		"torrent-remove [104] delete=true",
+	}
+	if diff := cmp.Diff(expected, transmission.calls); diff != "" {
+		t.Errorf("unexpected calls (-want +got):\n%s", diff)
+	}
+
+	// the magnet was kept in the trash, so it's purged once its data is here
+	magnetLocation := path.Join(dir, "trash", "bbbb")
+	if err = os.MkdirAll(path.Join(magnetLocation, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner = jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Nanosecond)}
+	if err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(magnetLocation); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be purged: %+v", magnetLocation, err)
+	}
+}
+
+func TestRunnerMovesBackTorrentsThatCantBeTrashed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, _ := trashTestTorrents(t, dir)
+	hash := withFile["hashString"].(string)
+	transmission := newFakeTransmissionState(t, withFile)
+	defer transmission.Close()
+	transmission.fail["torrent-remove"] = true
+	runner := jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Nanosecond)}
+	if err = runner.Run(context.Background()); err == nil {
+		t.Error("expected trashing to fail")
+	}
+	expected := []string{
+		"torrent-set-location [1] " + path.Join(dir, "trash", hash),
+		"torrent-remove [1] delete=false",
+		"torrent-set-location [1] /downloads",
+	}
+	if diff := cmp.Diff(expected, transmission.calls); diff != "" {
+		t.Errorf("unexpected calls (-want +got):\n%s", diff)
+	}
+	// nothing was recorded as trashed, so there's nothing to purge or restore
+	runner = jobs.Runner{Config: trashTestConfig(dir, transmission.URL, time.Hour)}
+	if err = runner.Restore(context.Background(), "", []string{hash}); err == nil {
+		t.Error("expected a torrent that couldn't be trashed not to be in the trash")
+	}
+}
+
+func TestRunnerKeepsTrashThatIsBackInTransmission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, _ := trashTestTorrents(t, dir)
+	location := path.Join(dir, "trash", withFile["hashString"].(string))
+	transmission := newFakeTransmissionState(t, withFile)
+	defer transmission.Close()
+	// the torrent was added again, from the trash, before its retention ran out
+	transmission.add = func(arguments fakeRPCArguments) (map[string]interface{}, bool) {
+		return fakeTorrent(5, withFile["hashString"].(string), "with file"), true
+	}
+	if err = os.MkdirAll(location, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := trashTestConfig(dir, transmission.URL, time.Nanosecond)
+	runner := jobs.Runner{Config: config}
+	err = runner.Run(context.Background())
+	if runErr, ok := err.(*jobs.RunError); !ok || len(runErr.Errors) != 1 || runErr.Errors[0].Job != "trash" {
+		t.Errorf("expected purging data that's in use to fail the trash job, got %+v", err)
+	}
+	if _, err = os.Stat(location); err != nil {
+		t.Errorf("expected %s to be kept: %+v", location, err)
+	}
+	// the trash is kept, so it's tried again rather than forgotten
+	config.Jobs = nil
+	runner = jobs.Runner{Config: config}
+	if err = runner.Run(context.Background()); err == nil {
+		t.Error("expected purging data that's in use to keep failing")
+	}
+}
+
+func TestRunnerSavesEveryInstanceWhenPurgingFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withFile, _ := trashTestTorrents(t, dir)
+	first := newFakeTransmissionState(t, withFile)
+	defer first.Close()
+	first.add = func(arguments fakeRPCArguments) (map[string]interface{}, bool) {
+		return fakeTorrent(5, withFile["hashString"].(string), "with file"), true
+	}
+	second := newFakeTransmissionState(t, fakeTorrent(1, "cccc", "other"))
+	defer second.Close()
+	config := trashTestConfig(dir, first.URL, time.Nanosecond)
+	config.Transmission = []jobs.TransmissionSettings{{Name: "first", Host: first.URL}, {Name: "second", Host: second.URL}}
+	config.Jobs[0].Instances = []string{"first"}
+	config.Jobs = append(config.Jobs, jobs.JobConfig{
+		Name:       "tag",
+		Instances:  []string{"second"},
+		TagOptions: &jobs.TagOptions{Name: "x", Condition: "true"},
+	})
+	runner := jobs.Runner{Config: config}
+	if err = runner.Run(context.Background()); err == nil {
+		t.Error("expected purging data that's in use to fail")
+	}
+	runner = jobs.Runner{Config: config}
+	results, err := runner.Eval(context.Background(), "second", `"x" in Torrent.Tags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Value != true {
+		t.Errorf("expected the tag to be saved, got %+v", results)
+	}
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hekmon/transmissionrpc"
+)
+
+const (
+	watchDoneDir   = "done"
+	watchFailedDir = "failed"
+)
+
+// watchedExtensions are the files a watch job adds. Magnet and text files hold magnet links, one per line.
+var watchedExtensions = map[string]bool{".torrent": true, ".magnet": true, ".txt": true}
+
+// watch adds every watched file in a watch job's directory, then moves each one into done/ or failed/ so it isn't
+// added again.
+func (r *instance) watch(ctx context.Context, job JobConfig) error {
+	directory := job.WatchOptions.Directory
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return fmt.Errorf("error reading watch directory %s: %+v", directory, err)
+	}
+	failed := 0
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || !watchedExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		file := filepath.Join(directory, entry.Name())
+		if r.DryRun {
+			log.Printf("DRY RUN: would add %s", file)
+			r.planWatchedFile(job, file)
+			r.simulateAdd(job, watchedName(file), "", job.WatchOptions.Tag)
+			continue
+		}
+		// one bad file shouldn't hold up the rest
+		if err = r.addWatchedFile(ctx, job, file); err != nil {
+			log.Printf("error adding %s: %+v", file, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d watched file(s) could not be added", failed)
+	}
+	return nil
+}
+
+// addWatchedFile adds the torrents in a watched file, then moves it into done/ or failed/.
+func (r *instance) addWatchedFile(ctx context.Context, job JobConfig, file string) error {
+	name := watchedName(file)
+	payloads, err := readWatchedFile(file)
+	if err != nil {
+		r.record(job, ActionAdd, &TransmissionTorrent{Name: name}, err)
+	}
+	for _, payload := range payloads {
+		log.Printf("[*] Adding %s", name)
+		if err = r.addTorrent(ctx, job, file, name, payload, "", job.WatchOptions.Tag); err != nil {
+			break
+		}
+	}
+	into := watchDoneDir
+	if err != nil {
+		into = watchFailedDir
+	}
+	if moveErr := moveWatchedFile(file, into); moveErr != nil {
+		if err != nil {
+			return fmt.Errorf("%+v, and %+v", err, moveErr)
+		}
+		return moveErr
+	}
+	return err
+}
+
+// readWatchedFile returns what to add for a .torrent file, or for each magnet link in a magnet or text file.
+func readWatchedFile(file string) ([]*transmissionrpc.TorrentAddPayload, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %+v", file, err)
+	}
+	if strings.EqualFold(filepath.Ext(file), ".torrent") {
+		metaInfo := base64.StdEncoding.EncodeToString(contents)
+		return []*transmissionrpc.TorrentAddPayload{{MetaInfo: &metaInfo}}, nil
+	}
+	var payloads []*transmissionrpc.TorrentAddPayload
+	for _, line := range strings.Split(string(contents), "\n") {
+		link := strings.TrimSpace(line)
+		if strings.HasPrefix(strings.ToLower(link), "magnet:?") {
+			payloads = append(payloads, &transmissionrpc.TorrentAddPayload{Filename: &link})
+		}
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("no magnet links in %s", file)
+	}
+	return payloads, nil
+}
+
+// moveWatchedFile moves a watched file into a subdirectory of its watch directory.
+func moveWatchedFile(file, into string) error {
+	directory := filepath.Join(filepath.Dir(file), into)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %+v", directory, err)
+	}
+	if err := os.Rename(file, filepath.Join(directory, filepath.Base(file))); err != nil {
+		return fmt.Errorf("error moving %s into %s: %+v", file, into, err)
+	}
+	return nil
+}
+
+// watchedName names a watched file's torrent until Transmission knows better.
+func watchedName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
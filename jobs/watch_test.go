@@ -0,0 +1,50 @@
+package jobs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark-ignacio/transmission-jobs/jobs"
+)
+
+func TestRunnerWatchesDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transmission-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.torrent":  "d8:announce0:e",
+		"b.magnet":   "magnet:?xt=urn:btih:aaaa\n",
+		"c.txt":      "not a magnet link",
+		"ignore.nfo": "magnet:?xt=urn:btih:bbbb",
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transmission, _ := fakeTransmission(t, 0, 0, `{
+		"torrents": [],
+		"torrent-added": {"id": 1, "name": "added", "hashString": "aaaa"}
+	}`)
+	defer transmission.Close()
+	runner := jobs.Runner{Config: jobs.Config{
+		Transmission: []jobs.TransmissionSettings{{Host: transmission.URL}},
+		Jobs: []jobs.JobConfig{{
+			Name:         "watch",
+			WatchOptions: &jobs.WatchOptions{Directory: dir, Tag: "watched"},
+		}},
+	}}
+	if err = runner.Run(context.Background()); err == nil {
+		t.Error("expected the file without a magnet link to fail the job")
+	}
+	for _, file := range []string{"done/a.torrent", "done/b.magnet", "failed/c.txt", "ignore.nfo"} {
+		if _, err = os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("expected %s to exist: %+v", file, err)
+		}
+	}
+}